@@ -0,0 +1,256 @@
+package expresso
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat selects the line format written by the access log middleware.
+type AccessLogFormat int
+
+const (
+	// AccessLogCommon writes the Apache Common Log Format:
+	// remote-ip - user [time] "method path protocol" status bytes
+	// Quotes, backslashes, spaces and control characters in the BasicAuth user are escaped.
+	AccessLogCommon AccessLogFormat = iota
+
+	// AccessLogCombined writes the Apache Combined Log Format, the Common format followed
+	// by the quoted referrer and user agent.
+	AccessLogCombined
+
+	// AccessLogJSON writes one JSON object per line, including the latency in milliseconds
+	// and the request ID, if assigned by the request ID middleware.
+	AccessLogJSON
+)
+
+// accessLogTime is the timestamp layout of the Common and Combined formats.
+const accessLogTime = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogOptions configures the middleware returned by NewAccessLogMiddleware.
+type AccessLogOptions struct {
+	Format AccessLogFormat // Line format, AccessLogCommon by default.
+	Output io.Writer       // Destination of the log lines, os.Stdout if nil. See RotatingFile for a size-rotated file.
+}
+
+// accessLogEntry holds the details of a completed request, in the field order of the JSON format.
+type accessLogEntry struct {
+	Time      time.Time `json:"time"`
+	RemoteIP  string    `json:"remote_ip"`
+	User      string    `json:"user,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Protocol  string    `json:"protocol"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	LatencyMs float64   `json:"latency_ms"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// NewAccessLogMiddleware returns a middleware writing a line for every request once it has completed,
+// including requests that panicked or were aborted by later middleware. Register it with App.Use,
+// before other middleware, so that every request is recorded.
+//
+//	logFile, err := expresso.NewRotatingFile("access.log", 10<<20, 5)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	app.Use(expresso.NewAccessLogMiddleware(expresso.AccessLogOptions{
+//		Format: expresso.AccessLogCombined,
+//		Output: logFile,
+//	}))
+func NewAccessLogMiddleware(opts AccessLogOptions) Middleware {
+	output := opts.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	var mu sync.Mutex // Serializes writes, as the output may not be safe for concurrent use.
+
+	return func(ctx *Context) {
+		start := time.Now()
+
+		ctx.cleanups = append(ctx.cleanups, func() {
+			r := ctx.RawRequest
+			entry := accessLogEntry{
+				Time:      start,
+				RemoteIP:  remoteIP(r),
+				Method:    r.Method,
+				Path:      r.URL.RequestURI(),
+				Protocol:  r.Proto,
+				Status:    ctx.ResponseStatus(),
+				Bytes:     ctx.ResponseSize(),
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				Referrer:  r.Referer(),
+				UserAgent: r.UserAgent(),
+				RequestID: ctx.RequestID(),
+			}
+			if user, _, ok := r.BasicAuth(); ok {
+				entry.User = user
+			}
+			if entry.Status == 0 {
+				entry.Status = http.StatusOK // net/http sends 200 when nothing was written.
+			}
+
+			line := entry.format(opts.Format)
+			mu.Lock()
+			defer mu.Unlock()
+			_, _ = io.WriteString(output, line)
+		})
+
+		ctx.Next()
+	}
+}
+
+// format renders the entry as a single line in the given format.
+func (e accessLogEntry) format(format AccessLogFormat) string {
+	if format == AccessLogJSON {
+		bs, _ := json.Marshal(e)
+		return string(bs) + "\n"
+	}
+
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = strconv.FormatInt(e.Bytes, 10)
+	}
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		orDash(e.RemoteIP), orDash(escapeLogItem(e.User)), e.Time.Format(accessLogTime),
+		e.Method, e.Path, e.Protocol, e.Status, bytes)
+	if format == AccessLogCombined {
+		line += fmt.Sprintf(" %q %q", orDash(e.Referrer), orDash(e.UserAgent))
+	}
+	return line + "\n"
+}
+
+// orDash returns "-", the Common Log Format placeholder for missing values, if s is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escapeLogItem escapes quotes, backslashes, control characters and spaces in s with Go escape
+// sequences, so a client-supplied value such as the BasicAuth user stays a single field of the line.
+func escapeLogItem(s string) string {
+	quoted := strconv.Quote(s)
+	return strings.ReplaceAll(quoted[1:len(quoted)-1], " ", `\x20`)
+}
+
+// remoteIP returns the IP address of the client, without the port.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RotatingFile is an io.WriteCloser appending to a file that is rotated once it reaches a maximum size.
+// On rotation the file is renamed with the suffix ".1", existing backups are shifted to ".2", ".3" and
+// so on, and backups beyond the configured count are removed. It is safe for concurrent use.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile opens, or creates, the file at path for appending. The file is rotated before a write
+// would make it exceed maxSize bytes, keeping at most maxBackups old files. A maxSize of zero disables rotation.
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends b to the file, rotating it first if needed.
+func (f *RotatingFile) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(b)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// open opens the file for appending and records its current size.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate closes the file, shifts the backups and opens a new, empty file. The caller must hold f.mu.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if f.maxBackups <= 0 {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return f.open()
+	}
+
+	_ = os.Remove(f.backup(f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(f.backup(i), f.backup(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, f.backup(1)); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// backup returns the path of the nth backup.
+func (f *RotatingFile) backup(n int) string {
+	return f.path + "." + strconv.Itoa(n)
+}
@@ -0,0 +1,170 @@
+package expresso
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// accessLog serves a request with a referrer, a user agent, a request ID and, unless user is empty,
+// BasicAuth credentials through an App logging in the given format, and returns the logged output.
+func accessLog(t *testing.T, format AccessLogFormat, user string) string {
+	t.Helper()
+	var out bytes.Buffer
+	app := newTestApp()
+	app.Use(NewRequestIDMiddleware(RequestIDOptions{}), NewAccessLogMiddleware(AccessLogOptions{Format: format, Output: &out}))
+	app.GET("/users/:id", func(ctx *Context) {
+		ctx.Status(201).Send(Text{Content: "created"})
+	})
+
+	req := httptest.NewRequest("GET", "/users/42?q=a%20b", nil)
+	req.RemoteAddr = "192.0.2.7:51234"
+	if user != "" {
+		req.SetBasicAuth(user, "secret")
+	}
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", `curl/8.0 "test"`)
+	req.Header.Set(DefaultRequestIDHeader, "req-1")
+	serve(app, req)
+	return out.String()
+}
+
+func TestAccessLogCommonAndCombined(t *testing.T) {
+	const combined = ` "https://example.com/" "curl/8.0 \"test\""`
+	tests := []struct {
+		format AccessLogFormat
+		user   string
+		field  string // The expected user field.
+		suffix string // The expected text after the byte count.
+	}{
+		{AccessLogCommon, "ana", "ana", ""},
+		{AccessLogCommon, "", "-", ""},
+		// A client-supplied user cannot add fields or lines.
+		{AccessLogCommon, "ana \"x\"\n", `ana\x20\"x\"\n`, ""},
+		{AccessLogCombined, "ana", "ana", combined},
+		{AccessLogCombined, `a\b`, `a\\b`, combined},
+	}
+	for _, tt := range tests {
+		pattern := `^192\.0\.2\.7 - ` + regexp.QuoteMeta(tt.field) +
+			` \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /users/42\?q=a%20b HTTP/1\.1" 201 7` +
+			regexp.QuoteMeta(tt.suffix) + `\n$`
+		if got := accessLog(t, tt.format, tt.user); !regexp.MustCompile(pattern).MatchString(got) {
+			t.Errorf("format %d, user %q: line = %q, want it to match %q", tt.format, tt.user, got, pattern)
+		}
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	line := accessLog(t, AccessLogJSON, "ana \"x\"")
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+		t.Fatalf("output = %q, want a single line", line)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"remote_ip":  "192.0.2.7",
+		"user":       "ana \"x\"",
+		"method":     "GET",
+		"path":       "/users/42?q=a%20b",
+		"protocol":   "HTTP/1.1",
+		"status":     201.0,
+		"bytes":      7.0,
+		"referrer":   "https://example.com/",
+		"user_agent": `curl/8.0 "test"`,
+		"request_id": "req-1",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["time"].(string); !ok {
+		t.Errorf("time = %v, want a timestamp", entry["time"])
+	}
+	if latency, ok := entry["latency_ms"].(float64); !ok || latency < 0 {
+		t.Errorf("latency_ms = %v, want a duration", entry["latency_ms"])
+	}
+}
+
+func TestAccessLogDefaultsTo200(t *testing.T) {
+	var out bytes.Buffer
+	app := newTestApp()
+	app.Use(NewAccessLogMiddleware(AccessLogOptions{Output: &out}))
+	app.GET("/", func(ctx *Context) {})
+
+	serve(app, httptest.NewRequest("GET", "/", nil))
+	if !strings.HasSuffix(out.String(), `"GET / HTTP/1.1" 200 -`+"\n") {
+		t.Errorf("line = %q, want status 200 and no bytes", out.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each write that would take the file past 10 bytes rotates it first.
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		if n, err := f.Write([]byte(line)); n != len(line) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", line, n, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		path:        "gggg\n",
+		path + ".1": "eeee\nffff\n",
+		path + ".2": "cccc\ndddd\n",
+	}
+	for name, content := range want {
+		bs, err := os.ReadFile(name)
+		if err != nil || string(bs) != content {
+			t.Errorf("%s = %q, %v, want %q", filepath.Base(name), bs, err, content)
+		}
+	}
+	// Backups beyond the configured count are removed.
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want at most 2 backups", filepath.Base(path))
+	}
+
+	if _, err := f.Write([]byte("late\n")); err != os.ErrClosed {
+		t.Errorf("Write after Close = %v, want %v", err, os.ErrClosed)
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte("old line\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The existing size counts towards the limit, so the first write rotates the file.
+	f, err := NewRotatingFile(path, 12, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("new line\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if bs, _ := os.ReadFile(path); string(bs) != "new line\n" {
+		t.Errorf("file = %q, want %q", bs, "new line\n")
+	}
+	// Without backups the old content is dropped.
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("%s.1 exists, want no backups", filepath.Base(path))
+	}
+}
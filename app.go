@@ -2,7 +2,7 @@ package expresso
 
 import (
 	"crypto/tls"
-	"encoding/xml"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -11,16 +11,32 @@ import (
 
 // Config holds server configuration settings such as read/write timeouts and maximum header bytes.
 type Config struct {
-	ReadTimeout    time.Duration // Maximum duration for reading the entire request, including the body.
-	WriteTimeout   time.Duration // Maximum duration before timing out writes of the response.
-	MaxHeaderBytes int           // Maximum number of bytes the server will read parsing the request header.
+	ReadTimeout          time.Duration              // Maximum duration for reading the entire request, including the body.
+	WriteTimeout         time.Duration              // Maximum duration before timing out writes of the response.
+	MaxHeaderBytes       int                        // Maximum number of bytes the server will read parsing the request header.
+	MiddlewareMode       MiddlewareMode             // How Context.Next advances the middleware chain, sequential by default.
+	ShutdownTimeout      time.Duration              // Grace period for in-flight requests to finish during Shutdown, zero waits indefinitely.
+	Development          bool                       // Development mode, re-parses changed templates on each render and shows detailed panic pages.
+	WebSocketCompression bool                       // Whether WebSocket routes negotiate permessage-deflate with clients that offer it.
+	WebSocketCheckOrigin func(r *http.Request) bool // Whether a WebSocket handshake is accepted from the request's Origin; if nil, only same-origin handshakes and those without an Origin are.
+	LogLevel             string                     // Minimum level of request log entries, e.g. LogLevelWarn; all entries are kept if empty.
+	MaxBodyBytes         int64                      // Maximum size of request bodies, larger ones fail with 413 Request Entity Too Large. Zero means no limit.
+	Uploads              UploadOptions              // Limits applied to multipart uploads, see Context.FormFile.
+	StrictNegotiation    bool                       // Whether Formatted replies 406 Not Acceptable when the Accept header matches none of its options, instead of sending Default. Error responses are exempt.
 }
 
 // App is the main structure of the application, encapsulating the router and server configuration.
 type App struct {
-	router    *httprouter.Router // HTTP request router.
-	Config                       // Server configuration settings.
-	TLSConfig *tls.Config        // TLS configuration for HTTPS server.
+	router      *httprouter.Router // HTTP request router.
+	middlewares []Middleware       // Application-wide middleware registered with Use.
+	onError     ErrorHandler       // Handler for errors returned by handlers, set with OnError.
+	lifecycle   *lifecycle         // Running servers and shutdown hooks.
+	views       *ViewEngine        // View engine used by Context.Render, set with Views.
+	onPanic     PanicHandler       // Handler for panics in middleware and handlers, set with OnPanic.
+	logger      *slog.Logger       // Destination of request log entries, set with SetLogger; nil for the console.
+	renderers   *rendererRegistry  // Renderers for custom media types, set with RegisterRenderer.
+	Config                         // Server configuration settings.
+	TLSConfig   *tls.Config        // TLS configuration for HTTPS server.
 }
 
 // DefaultApp creates and returns an App instance with default configurations.
@@ -28,33 +44,53 @@ type App struct {
 //   - ReadTimeout: 10 seconds
 //   - WriteTimeout: 10 seconds
 //   - MaxHeaderBytes: 1MB (1 << 20 bytes)
-func DefaultApp() App {
+//   - ShutdownTimeout: 10 seconds
+//   - MaxBodyBytes: 32MB (32 << 20 bytes)
+func DefaultApp() *App {
 	return NewApp(Config{
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		MaxHeaderBytes: 1 << 20,
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    10 * time.Second,
+		MaxHeaderBytes:  1 << 20,
+		ShutdownTimeout: 10 * time.Second,
+		MaxBodyBytes:    32 << 20,
 	}, nil)
 }
 
 // NewApp creates and returns an App instance with custom configuration settings provided by the user.
-func NewApp(c Config, t *tls.Config) App {
-	return App{
+// Requests that match no route, including automatic OPTIONS and 405 Method Not Allowed replies,
+// still run the application-wide middleware registered with Use.
+func NewApp(c Config, t *tls.Config) *App {
+	a := &App{
 		router:    httprouter.New(),
+		lifecycle: &lifecycle{},
+		renderers: &rendererRegistry{},
 		Config:    c,
 		TLSConfig: t,
 	}
+
+	a.HandleNotFound(func(ctx *Context) {
+		ctx.Fail(NewHTTPError(http.StatusNotFound, "", nil))
+	})
+	a.router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.handle(func(ctx *Context) {
+			ctx.Fail(NewHTTPError(http.StatusMethodNotAllowed, "", nil))
+		})(w, r, nil)
+	})
+	a.router.GlobalOPTIONS = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.handle(func(ctx *Context) {
+			ctx.SendStatus(http.StatusOK)
+		})(w, r, nil)
+	})
+	return a
 }
 
 // ListenAndServe starts the HTTP server on the specified address with the settings provided in the App's Config.
-func (a App) ListenAndServe(addr string, cb func(error)) error {
-	server := http.Server{
-		Addr:           addr,
-		Handler:        a.router,
-		ReadTimeout:    a.Config.ReadTimeout,
-		WriteTimeout:   a.Config.WriteTimeout,
-		MaxHeaderBytes: a.Config.MaxHeaderBytes,
+// After Shutdown it returns http.ErrServerClosed.
+func (a *App) ListenAndServe(addr string, cb func(error)) error {
+	err := a.prepare()
+	if err == nil {
+		err = a.newServer(addr).ListenAndServe()
 	}
-	err := server.ListenAndServe()
 	if cb != nil {
 		cb(err)
 	}
@@ -62,145 +98,186 @@ func (a App) ListenAndServe(addr string, cb func(error)) error {
 }
 
 // ListenAndServeTLS starts the HTTPS server with the given certificate and key files on the specified address.
-func (a App) ListenAndServeTLS(addr, certFile, keyFile string, cb func(error)) error {
-	server := http.Server{
+// After Shutdown it returns http.ErrServerClosed.
+func (a *App) ListenAndServeTLS(addr, certFile, keyFile string, cb func(error)) error {
+	err := a.prepare()
+	if err == nil {
+		err = a.newServer(addr).ListenAndServeTLS(certFile, keyFile)
+	}
+	if cb != nil {
+		cb(err)
+	}
+	return err
+}
+
+// prepare runs the startup checks that must pass before serving, such as parsing the views.
+func (a *App) prepare() error {
+	if a.views != nil {
+		return a.views.Load()
+	}
+	return nil
+}
+
+// ServeHTTP dispatches the request through the App's router, making App usable as an http.Handler,
+// e.g. with httptest.NewServer, another mux or a custom http.Server.
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.router.ServeHTTP(w, r)
+}
+
+// newServer creates an http.Server for the App's Config and tracks it so Shutdown can drain it.
+func (a *App) newServer(addr string) *http.Server {
+	server := &http.Server{
 		Addr:           addr,
-		Handler:        a.router,
+		Handler:        a,
 		ReadTimeout:    a.Config.ReadTimeout,
 		WriteTimeout:   a.Config.WriteTimeout,
 		MaxHeaderBytes: a.Config.MaxHeaderBytes,
 		TLSConfig:      a.TLSConfig,
 	}
-	err := server.ListenAndServeTLS(certFile, keyFile)
-	if cb != nil {
-		cb(err)
-	}
-	return err
+	a.lifecycle.add(server)
+	return server
 }
 
-func (a App) CORS(cors Cors) {
+// CORS registers an OPTIONS handler for cors.Path that replies with the static CORS headers in cors.
+//
+// Deprecated: Use NewCorsMiddleware with App.Use, which handles preflight requests for every route.
+func (a *App) CORS(cors Cors) {
 	handler := func(ctx *Context) {
 		ctx.SendStatus(http.StatusOK)
 	}
-	a.router.OPTIONS(cors.Path, handle(NewCorsHandler(cors), handler))
+	a.router.OPTIONS(cors.Path, a.handle(NewCorsHandler(cors), handler))
+}
+
+// Use registers application-wide middleware. It runs for every request, including
+// static files and the not found handler, before any group or route middleware.
+// Application-wide middleware runs in the order it was registered, and applies to
+// routes registered both before and after the call to Use.
+func (a *App) Use(middlewares ...Middleware) {
+	a.middlewares = append(a.middlewares, middlewares...)
+}
+
+// OnError sets the handler used to turn errors returned by a Handler, or passed to
+// Context.Fail, into responses. By default DefaultErrorHandler is used.
+func (a *App) OnError(handler ErrorHandler) {
+	a.onError = handler
 }
 
 // HEAD registers a HEAD request handler for the specified path with optional middleware.
-func (a App) HEAD(path string, middlewares ...Middleware) {
-	a.router.HEAD(path, handle(middlewares...))
+func (a *App) HEAD(path string, middlewares ...Middleware) {
+	a.router.HEAD(path, a.handle(middlewares...))
 }
 
 // OPTIONS registers an OPTIONS request handler for the specified path with optional middleware.
-func (a App) OPTIONS(path string, middlewares ...Middleware) {
-	a.router.OPTIONS(path, handle(middlewares...))
+func (a *App) OPTIONS(path string, middlewares ...Middleware) {
+	a.router.OPTIONS(path, a.handle(middlewares...))
 }
 
 // GET registers a GET request handler for the specified path with optional middleware.
-func (a App) GET(path string, middlewares ...Middleware) {
-	a.router.GET(path, handle(middlewares...))
+func (a *App) GET(path string, middlewares ...Middleware) {
+	a.router.GET(path, a.handle(middlewares...))
 }
 
 // POST registers a POST request handler for the specified path with optional middleware.
-func (a App) POST(path string, middlewares ...Middleware) {
-	a.router.POST(path, handle(middlewares...))
+func (a *App) POST(path string, middlewares ...Middleware) {
+	a.router.POST(path, a.handle(middlewares...))
 }
 
 // PATCH registers a PATCH request handler for the specified path with optional middleware.
-func (a App) PATCH(path string, middlewares ...Middleware) {
-	a.router.PATCH(path, handle(middlewares...))
+func (a *App) PATCH(path string, middlewares ...Middleware) {
+	a.router.PATCH(path, a.handle(middlewares...))
 }
 
 // PUT registers a PUT request handler for the specified path with optional middleware.
-func (a App) PUT(path string, middlewares ...Middleware) {
-	a.router.PUT(path, handle(middlewares...))
+func (a *App) PUT(path string, middlewares ...Middleware) {
+	a.router.PUT(path, a.handle(middlewares...))
 }
 
 // DELETE registers a DELETE request handler for the specified path with optional middleware.
-func (a App) DELETE(path string, middlewares ...Middleware) {
-	a.router.DELETE(path, handle(middlewares...))
+func (a *App) DELETE(path string, middlewares ...Middleware) {
+	a.router.DELETE(path, a.handle(middlewares...))
 }
 
 // ServeStatic serves static files from the provided directory for the specified path.
-func (a App) ServeStatic(path string, root http.FileSystem) {
-	a.router.ServeFiles(path, root)
+// The path must end with "/*filepath", e.g. "/public/*filepath".
+func (a *App) ServeStatic(path string, root http.FileSystem) {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic("path must end with /*filepath in path '" + path + "'")
+	}
+
+	fileServer := http.FileServer(root)
+	a.router.GET(path, a.handle(func(ctx *Context) {
+		ctx.Response.writeHeaders()
+		// Serve a copy with the file path, leaving the request seen by loggers untouched.
+		r := *ctx.RawRequest
+		u := *r.URL
+		u.Path = ctx.Params.ByName("filepath")
+		r.URL = &u
+		fileServer.ServeHTTP(ctx.Response.w, &r)
+	}))
 }
 
 // HandleNotFound sets up a custom 404 Not Found handler with optional middleware.
-func (a App) HandleNotFound(middlewares ...Middleware) {
+func (a *App) HandleNotFound(middlewares ...Middleware) {
 	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handle(middlewares...)(w, r, nil)
+		a.handle(middlewares...)(w, r, nil)
 	})
 	a.router.NotFound = h
 }
 
-// HandleError sets up a custom error handler with optional middleware.
-func (a App) HandleError(handler func(http.ResponseWriter, *http.Request, interface{})) {
-	a.router.PanicHandler = handler
+// HandleError sets up a custom handler for panics, receiving the raw response writer and request.
+//
+// Deprecated: Use OnPanic, whose handler also receives the request's Context and the stack trace.
+func (a *App) HandleError(handler func(http.ResponseWriter, *http.Request, interface{})) {
+	a.OnPanic(func(ctx *Context, recovered interface{}, stack []byte) {
+		handler(ctx.Response.w, ctx.RawRequest, recovered)
+	})
 }
 
-// handle is a helper function that processes a list of middleware and invokes them sequentially.
-func handle(middlewares ...Middleware) func(http.ResponseWriter, *http.Request, httprouter.Params) {
+// handle is a helper function that processes a list of middleware and invokes them sequentially,
+// preceded by the application-wide middleware registered with Use.
+func (a *App) handle(middlewares ...Middleware) func(http.ResponseWriter, *http.Request, httprouter.Params) {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		a.limitBody(w, r)                        // Cap the body before anything reads it.
 		req := requestFromHttpRequest(r)         // Convert the incoming HTTP request to a custom request type.
 		res := responseFromHttpResponseWriter(w) // Convert the response writer to a custom response type.
 
-		if req == nil {
-			// Handle errors if the request couldn't be processed.
-			res.Status(500).Formatted(r, Formatted{
-				Text: &Text{"Error - Unable to process the request"},
-				HTML: &HTML{"<html><head><title>Error - Unable to process the request</title></head><body>Error - Unable to process the request</body></html>"},
-				JSON: &JSON{
-					Data: map[string]interface{}{
-						"status": 500,
-						"error":  "Unable to process the request",
-					},
-				},
-				XML: &XML{
-					Data: struct {
-						XMLName xml.Name `xml:"error"`
-						Status  int      `xml:"status"`
-						Error   string   `xml:"error"`
-					}{
-						Status: 500,
-						Error:  "Unable to process the request",
-					},
-				},
-				YAML: &YAML{
-					Data: map[string]interface{}{
-						"status": 500,
-						"error":  "Unable to process the request",
-					},
-				},
-				Default: &JSON{
-					Data: map[string]interface{}{
-						"status": 500,
-						"error":  "Unable to process the request",
-					},
-				},
-			})
-
-			return
-		}
-
 		req.Params = p // Attach the URL parameters to the request.
 
+		// Build the chain at request time so middleware added with Use after this route still applies.
+		chain := make([]Middleware, 0, len(a.middlewares)+len(middlewares))
+		chain = append(chain, a.middlewares...)
+		chain = append(chain, middlewares...)
+
+		// Route the request's log entries to the App's logger, dropping those below the configured level.
+		logger := NewLogger(req)
+		logger.sink = a.logger
+		logger.minLevel = slogLevel(a.Config.LogLevel)
+		res.rec.logger = logger
+
 		// Initialize the context for middleware processing.
 		ctx := &Context{
-			Request:  req,
-			Response: res,
-			Extras:   map[interface{}]interface{}{},
-			goNext:   false,
-			Logger:   NewLogger(req),
+			Request:           req,
+			Response:          res,
+			Extras:            map[interface{}]interface{}{},
+			goNext:            false,
+			middlewares:       chain,
+			onion:             a.Config.MiddlewareMode == MiddlewareModeOnion,
+			onError:           a.onError,
+			views:             a.views,
+			onPanic:           a.onPanic,
+			development:       a.Config.Development,
+			uploads:           a.Config.Uploads,
+			strictNegotiation: a.Config.StrictNegotiation,
+			renderers:         a.renderers,
+			shutdown:          a.lifecycle.draining(),
+			Logger:            logger,
 		}
 		ctx.Response.Context = ctx // Link the response to the context.
 
-		// Execute the middleware chain.
-		for _, middleware := range middlewares {
-			middleware(ctx)
-			if !ctx.goNext {
-				break
-			}
-			ctx.goNext = false
+		// Execute the middleware chain, then release anything held for the request.
+		ctx.runRecovered()
+		for i := len(ctx.cleanups) - 1; i >= 0; i-- {
+			ctx.cleanups[i]() // In reverse order, so middleware registered first cleans up last.
 		}
 
 		// Log the response context if needed.
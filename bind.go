@@ -0,0 +1,379 @@
+package expresso
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultMultipartMemory is the maximum number of bytes of a multipart form kept in memory when
+// UploadOptions.MaxMemory is zero, the remainder being stored in temporary files.
+const defaultMultipartMemory = 32 << 20
+
+// BindError describes a part of the request that could not be decoded into the bind target.
+// Bind and its variants return it wrapped in an HTTPError with status 400 Bad Request.
+type BindError struct {
+	Source string // The part of the request being decoded, e.g. "JSON body" or "query parameter".
+	Field  string // The offending field or key, empty if the input as a whole is malformed.
+	Reason string // A description of what is wrong with the input.
+	Err    error  // The underlying decoding error, if any.
+}
+
+// Error returns a description of the error suitable for sending to the client.
+func (e *BindError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("malformed %s: %s", e.Source, e.Reason)
+	}
+	return fmt.Sprintf("invalid %s %q: %s", e.Source, e.Field, e.Reason)
+}
+
+// Unwrap returns the underlying decoding error.
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// Bind decodes the request body into v, which must be a pointer, based on the Content-Type header.
+// JSON, XML and YAML bodies are decoded with their standard struct tags, MessagePack and CBOR bodies
+// with the "json" tags, while url-encoded and multipart forms are decoded into struct fields using the "form" tag.
+// Bodies are decoded as they are read, unless already cached by BodyBytes. Malformed input results in
+// a 400 HTTPError, a body larger than Config.MaxBodyBytes in a 413 and an unsupported content type in a 415.
+// The decoded value is then checked with Validate, see ValidationError.
+func (c *Context) Bind(v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(c.Request.Headers.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/json":
+		if err := decodeJSON(c.BodyReader(), v); err != nil {
+			return decodeError(err, jsonBindError)
+		}
+	case "application/xml", "text/xml":
+		if err := decodeXML(c.BodyReader(), v); err != nil {
+			return decodeError(err, func(err error) *BindError {
+				return &BindError{Source: "XML body", Reason: err.Error(), Err: err}
+			})
+		}
+	case "application/x-yaml", "application/yaml", "text/yaml":
+		if err := yaml.NewDecoder(c.BodyReader()).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+			return decodeError(err, func(err error) *BindError {
+				return &BindError{Source: "YAML body", Reason: err.Error(), Err: err}
+			})
+		}
+	case MsgPackMediaType, "application/x-msgpack", "application/vnd.msgpack":
+		if err := decodeMsgPack(c.BodyReader(), v); err != nil {
+			return decodeError(err, binaryBindError("MessagePack"))
+		}
+	case CBORMediaType:
+		if err := decodeCBOR(c.BodyReader(), v); err != nil {
+			return decodeError(err, binaryBindError("CBOR"))
+		}
+	case "application/x-www-form-urlencoded":
+		err := c.Request.formErr
+		if err == nil {
+			err = c.RawRequest.ParseForm()
+		}
+		if err != nil {
+			return decodeError(err, func(err error) *BindError {
+				return &BindError{Source: "form body", Reason: err.Error(), Err: err}
+			})
+		}
+		if err := bindValues(v, "form", "form field", lookupValues(c.RawRequest.PostForm)); err != nil {
+			return err
+		}
+	case "multipart/form-data":
+		if err := c.parseMultipart(); err != nil {
+			return decodeError(err, func(err error) *BindError {
+				return &BindError{Source: "multipart body", Reason: err.Error(), Err: err}
+			})
+		}
+		if err := bindValues(v, "form", "form field", lookupValues(c.RawRequest.MultipartForm.Value)); err != nil {
+			return err
+		}
+	case "":
+		return NewHTTPError(http.StatusUnsupportedMediaType, "missing content type", nil)
+	default:
+		return NewHTTPError(http.StatusUnsupportedMediaType, "unsupported content type: "+mediaType, nil)
+	}
+	return Validate(v)
+}
+
+// BindQuery decodes the URL query parameters into the struct pointed to by v using the "query" tag.
+// Like Bind, it validates the result, as do BindParams and BindHeaders.
+func (c *Context) BindQuery(v interface{}) error {
+	return bindValues(v, "query", "query parameter", lookupValues(c.RawRequest.URL.Query()))
+}
+
+// BindParams decodes the route parameters into the struct pointed to by v using the "param" tag.
+func (c *Context) BindParams(v interface{}) error {
+	return bindValues(v, "param", "path parameter", func(name string) []string {
+		for _, p := range c.Params {
+			if p.Key == name {
+				return []string{p.Value}
+			}
+		}
+		return nil
+	})
+}
+
+// BindHeaders decodes the request headers into the struct pointed to by v using the "header" tag.
+// Header names are matched case-insensitively.
+func (c *Context) BindHeaders(v interface{}) error {
+	return bindValues(v, "header", "header", func(name string) []string {
+		return c.Request.Headers[textproto.CanonicalMIMEHeaderKey(name)]
+	})
+}
+
+// badRequest wraps a BindError in a 400 HTTPError.
+func badRequest(err *BindError) error {
+	return NewHTTPError(http.StatusBadRequest, err.Error(), err)
+}
+
+// decodeError converts an error from decoding the body into an HTTPError: 413 if the body exceeds
+// Config.MaxBodyBytes, or a 400 wrapping the BindError built by bindError otherwise.
+func decodeError(err error, bindError func(error) *BindError) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return BodyError(err)
+	}
+	if errors.Is(err, io.EOF) {
+		err = errors.New("empty body")
+	}
+	return badRequest(bindError(err))
+}
+
+// decodeJSON decodes a single JSON value from r into v, rejecting any data that follows it.
+func decodeJSON(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return err
+		}
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// decodeXML decodes a single XML element from r into v, rejecting any data that follows it other
+// than the whitespace, comments and processing instructions XML allows after the root element.
+func decodeXML(r io.Reader, v interface{}) error {
+	dec := xml.NewDecoder(r)
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return err
+		}
+		switch token := token.(type) {
+		case xml.Comment, xml.ProcInst:
+			continue
+		case xml.CharData:
+			if len(bytes.TrimSpace(token)) == 0 {
+				continue
+			}
+		}
+		return errors.New("unexpected data after the XML element")
+	}
+}
+
+// jsonBindError converts a JSON decoding error into a BindError naming the offending field where possible.
+func jsonBindError(err error) *BindError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return &BindError{
+			Source: "JSON field",
+			Field:  typeErr.Field,
+			Reason: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value),
+			Err:    err,
+		}
+	}
+	return &BindError{Source: "JSON body", Reason: err.Error(), Err: err}
+}
+
+// binaryBindError returns a function converting a MessagePack or CBOR decoding error into a BindError
+// naming the offending field where possible.
+func binaryBindError(format string) func(error) *BindError {
+	return func(err error) *BindError {
+		var typeErr *codecTypeError
+		if errors.As(err, &typeErr) && typeErr.field != "" {
+			return &BindError{
+				Source: format + " field",
+				Field:  typeErr.field,
+				Reason: fmt.Sprintf("expected %s, got %s", typeErr.want, typeErr.got),
+				Err:    err,
+			}
+		}
+		return &BindError{Source: format + " body", Reason: err.Error(), Err: err}
+	}
+}
+
+// lookupValues returns a lookup function over url.Values style maps.
+func lookupValues(values map[string][]string) func(string) []string {
+	return func(name string) []string {
+		return values[name]
+	}
+}
+
+// bindValues decodes string values into the fields of the struct pointed to by v, then validates it.
+// Each field is looked up by the name in its tag, or by its Go name if the tag is absent.
+// Fields tagged "-" are skipped and untagged embedded structs are decoded recursively.
+func bindValues(v interface{}, tag, source string, lookup func(string) []string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expresso: bind target must be a non-nil pointer to a struct, got %T", v)
+	}
+	if err := bindStruct(rv.Elem(), tag, source, lookup); err != nil {
+		return err
+	}
+	return Validate(v)
+}
+
+// bindStruct decodes values into the fields of the struct value rv.
+func bindStruct(rv reflect.Value, tag, source string, lookup func(string) []string) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, tagged := field.Tag.Lookup(tag)
+		name = strings.Split(name, ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		fv := rv.Field(i)
+		if field.Anonymous && !tagged && indirectType(field.Type).Kind() == reflect.Struct {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					fv.Set(reflect.New(field.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if err := bindStruct(fv, tag, source, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		values := lookup(name)
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(fv, values); err != nil {
+			return badRequest(&BindError{Source: source, Field: name, Reason: err.Error(), Err: err})
+		}
+	}
+	return nil
+}
+
+// indirectType returns the element type of pointer types, and t otherwise.
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// setField decodes values into fv. Slices receive every value, other kinds only the first.
+func setField(fv reflect.Value, values []string) error {
+	if reflect.PointerTo(fv.Type()).Implements(textUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(values[0]))
+	}
+
+	switch fv.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(fv.Type().Elem())
+		if err := setField(elem.Elem(), values); err != nil {
+			return err
+		}
+		fv.Set(elem)
+		return nil
+	case reflect.Slice:
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setField(slice.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	default:
+		return setScalar(fv, values[0])
+	}
+}
+
+// setScalar parses value into fv according to its kind.
+func setScalar(fv reflect.Value, value string) error {
+	invalid := fmt.Errorf("expected %s, got %q", fv.Type(), value)
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalid
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if fv.Type() == durationType {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return invalid
+			}
+			fv.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return invalid
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return invalid
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return invalid
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
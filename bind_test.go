@@ -0,0 +1,245 @@
+package expresso
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindUser struct {
+	Name  string   `json:"name" xml:"name" yaml:"name" form:"name" validate:"required"`
+	Age   int      `json:"age" xml:"age" yaml:"age" form:"age"`
+	Tags  []string `json:"tags" xml:"tag" yaml:"tags" form:"tag"`
+	Admin bool     `json:"admin" xml:"admin" yaml:"admin" form:"admin"`
+}
+
+// bindRequest runs a request with the given body and content type through Bind, returning the
+// decoded value and error.
+func bindRequest(t *testing.T, contentType, body string) (bindUser, error) {
+	t.Helper()
+	app := newTestApp()
+	var (
+		user bindUser
+		err  error
+	)
+	app.POST("/", func(ctx *Context) {
+		err = ctx.Bind(&user)
+		ctx.SendStatus(http.StatusNoContent)
+	})
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	serve(app, req)
+	return user, err
+}
+
+// statusOf returns the status code of an HTTPError, or 0 for other errors.
+func statusOf(err error) int {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	return 0
+}
+
+func TestBindFormats(t *testing.T) {
+	tests := []struct {
+		contentType, body string
+	}{
+		{"application/json", `{"name":"ann","age":30,"tags":["a","b"],"admin":true}`},
+		{"application/json; charset=utf-8", `{"name":"ann","age":30,"tags":["a","b"],"admin":true}`},
+		{"application/xml", `<user><name>ann</name><age>30</age><tag>a</tag><tag>b</tag><admin>true</admin></user>`},
+		{"text/xml", `<user><name>ann</name><age>30</age><tag>a</tag><tag>b</tag><admin>true</admin></user>`},
+		// Whitespace, comments and processing instructions may follow the root element.
+		{"application/xml", `<?xml version="1.0"?><user><name>ann</name><age>30</age><tag>a</tag><tag>b</tag><admin>true</admin></user>` + "\n<!-- end --><?pi?>\n"},
+		{"application/x-yaml", "name: ann\nage: 30\ntags: [a, b]\nadmin: true\n"},
+		{"application/x-www-form-urlencoded", "name=ann&age=30&tag=a&tag=b&admin=true"},
+	}
+	for _, tt := range tests {
+		user, err := bindRequest(t, tt.contentType, tt.body)
+		if err != nil {
+			t.Errorf("%s: Bind() = %v", tt.contentType, err)
+			continue
+		}
+		if user.Name != "ann" || user.Age != 30 || len(user.Tags) != 2 || user.Tags[1] != "b" || !user.Admin {
+			t.Errorf("%s: Bind() decoded %+v", tt.contentType, user)
+		}
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	tests := []struct {
+		name, contentType, body string
+		status                  int
+		message                 string
+	}{
+		{"missing content type", "", `{}`, 415, "missing content type"},
+		{"unsupported content type", "text/csv", "a,b", 415, "unsupported content type: text/csv"},
+		{"malformed JSON", "application/json", `{"name":`, 400, "malformed JSON body"},
+		{"empty JSON", "application/json", ``, 400, "malformed JSON body: empty body"},
+		{"wrong JSON type", "application/json", `{"name":"ann","age":"old"}`, 400, `invalid JSON field "age"`},
+		{"wrong form type", "application/x-www-form-urlencoded", "name=ann&age=old", 400, `invalid form field "age"`},
+		{"malformed XML", "application/xml", `<user><name>`, 400, "malformed XML body"},
+		{"trailing JSON", "application/json", `{"name":"ann"}{"name":"bob"}`, 400, "unexpected data after the JSON value"},
+		{"trailing XML element", "application/xml", `<user><name>ann</name></user><user><name>bob</name></user>`, 400, "unexpected data after the XML element"},
+		{"trailing XML text", "application/xml", `<user><name>ann</name></user> junk`, 400, "unexpected data after the XML element"},
+		{"validation", "application/json", `{"age":3}`, 0, "validation failed: name is required"},
+	}
+	for _, tt := range tests {
+		_, err := bindRequest(t, tt.contentType, tt.body)
+		if err == nil {
+			t.Errorf("%s: Bind() = nil, want an error", tt.name)
+			continue
+		}
+		if got := statusOf(err); got != tt.status {
+			t.Errorf("%s: status = %d, want %d (%v)", tt.name, got, tt.status, err)
+		}
+		if !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%s: error = %q, want it to contain %q", tt.name, err, tt.message)
+		}
+	}
+}
+
+func TestBindBodyTooLarge(t *testing.T) {
+	app := newTestApp()
+	app.Config.MaxBodyBytes = 16
+	var err error
+	app.POST("/", func(ctx *Context) {
+		var user bindUser
+		err = ctx.Bind(&user)
+		ctx.SendStatus(http.StatusNoContent)
+	})
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"`+strings.Repeat("x", 64)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	serve(app, req)
+	if statusOf(err) != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Bind() = %v, want a 413 HTTPError", err)
+	}
+}
+
+func TestBindErrorResponse(t *testing.T) {
+	app := newTestApp()
+	app.POST("/", Catch(func(ctx *Context) error {
+		var user bindUser
+		return ctx.Bind(&user)
+	}))
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"age":3}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	w := serve(app, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	var body struct {
+		Fields []FieldError `json:"fields"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body.Fields) != 1 || body.Fields[0].Field != "name" {
+		t.Fatalf("body = %s (%v)", w.Body.String(), err)
+	}
+}
+
+func TestBindQueryParamsHeaders(t *testing.T) {
+	type query struct {
+		Page    int           `query:"page"`
+		Sort    []string      `query:"sort"`
+		Timeout time.Duration `query:"timeout"`
+		Limit   *int          `query:"limit"`
+		Skipped string        `query:"-"`
+	}
+	type params struct {
+		ID uint64 `param:"id"`
+	}
+	type headers struct {
+		Token string `header:"x-token" validate:"required"`
+	}
+
+	app := newTestApp()
+	var (
+		q   query
+		p   params
+		h   headers
+		err error
+	)
+	app.GET("/users/:id", func(ctx *Context) {
+		q, p, h = query{}, params{}, headers{}
+		err = errors.Join(ctx.BindQuery(&q), ctx.BindParams(&p), ctx.BindHeaders(&h))
+		ctx.SendStatus(http.StatusNoContent)
+	})
+
+	values := url.Values{"page": {"2"}, "sort": {"name", "-age"}, "timeout": {"1.5s"}, "limit": {"10"}, "Skipped": {"x"}}
+	req := httptest.NewRequest("GET", "/users/42?"+values.Encode(), nil)
+	req.Header.Set("X-Token", "secret")
+	serve(app, req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Page != 2 || len(q.Sort) != 2 || q.Sort[1] != "-age" || q.Timeout != 1500*time.Millisecond || q.Limit == nil || *q.Limit != 10 || q.Skipped != "" {
+		t.Errorf("BindQuery() decoded %+v", q)
+	}
+	if p.ID != 42 {
+		t.Errorf("BindParams() decoded %+v", p)
+	}
+	if h.Token != "secret" {
+		t.Errorf("BindHeaders() decoded %+v", h)
+	}
+
+	req = httptest.NewRequest("GET", "/users/abc?page=x", nil)
+	serve(app, req)
+	if err == nil || !strings.Contains(err.Error(), `invalid query parameter "page"`) || !strings.Contains(err.Error(), `invalid path parameter "id"`) || !strings.Contains(err.Error(), "Token is required") {
+		t.Errorf("errors = %v", err)
+	}
+}
+
+func TestBindJSONTrailingData(t *testing.T) {
+	type payload struct {
+		Name string `json:"name"`
+	}
+	app := newTestApp()
+	app.POST("/", func(ctx *Context) {
+		var p payload
+		if err := ctx.Bind(&p); err != nil {
+			ctx.Fail(err)
+			return
+		}
+		ctx.Send(Text{Content: p.Name})
+	})
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"name":"a"}`, http.StatusOK},
+		{"{\"name\":\"a\"}\n  ", http.StatusOK},
+		{`{"name":"a"}{"name":"b"}`, http.StatusBadRequest},
+		{`{"name":"a"} 1`, http.StatusBadRequest},
+		{`{"name":"a"}}`, http.StatusBadRequest},
+		{`{"name":"a"} garbage`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := serve(app, req)
+		if w.Code != tt.code {
+			t.Errorf("body %q: status = %d, want %d: %s", tt.body, w.Code, tt.code, w.Body.String())
+		}
+	}
+}
+
+func TestBindErrorMessage(t *testing.T) {
+	_, err := bindRequest(t, "application/json", ``)
+	if got, want := err.Error(), "400 malformed JSON body: empty body"; got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+	var bindErr *BindError
+	if !errors.As(err, &bindErr) || bindErr.Source != "JSON body" {
+		t.Errorf("error = %#v, want it to wrap the BindError", err)
+	}
+}
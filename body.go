@@ -0,0 +1,67 @@
+package expresso
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// errBodyConsumed is returned by BodyBytes after the body was streamed with BodyReader.
+var errBodyConsumed = NewHTTPError(http.StatusInternalServerError, "", errors.New("expresso: request body already consumed by BodyReader"))
+
+// BodyReader returns the request body for streaming, without reading it into memory. Reading more
+// than Config.MaxBodyBytes fails with an *http.MaxBytesError, see BodyError. If the body was already
+// read with BodyBytes, the reader returns the cached bytes.
+func (c *Context) BodyReader() io.Reader {
+	if c.Request.Body != nil {
+		return bytes.NewReader(c.Request.Body)
+	}
+	c.Request.bodyConsumed = true
+	if c.RawRequest.Body == nil {
+		return http.NoBody
+	}
+	return c.RawRequest.Body
+}
+
+// BodyBytes reads the whole request body on first use and caches it in Request.Body, so it can be
+// read again, e.g. by a logging middleware and then by Bind. It returns a 413 HTTPError if the body
+// is larger than Config.MaxBodyBytes, and a 400 HTTPError if it cannot be read.
+func (c *Context) BodyBytes() ([]byte, error) {
+	if c.Request.Body != nil {
+		return c.Request.Body, nil
+	}
+	if c.Request.bodyConsumed {
+		return nil, errBodyConsumed
+	}
+
+	bs, err := io.ReadAll(c.BodyReader())
+	if err != nil {
+		return nil, BodyError(err)
+	}
+	c.Request.Body = bs
+	c.Request.bodyConsumed = false
+	return bs, nil
+}
+
+// BodyError converts an error from reading the request body into an HTTPError: 413 Request Entity Too
+// Large if the body exceeds Config.MaxBodyBytes, 400 Bad Request otherwise. HTTPErrors are returned as is.
+func BodyError(err error) error {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return err
+	}
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return NewHTTPError(http.StatusRequestEntityTooLarge, "request body larger than "+strconv.FormatInt(maxErr.Limit, 10)+" bytes", err)
+	}
+	return NewHTTPError(http.StatusBadRequest, "reading request body: "+err.Error(), err)
+}
+
+// limitBody caps the request body at the App's MaxBodyBytes.
+func (a *App) limitBody(w http.ResponseWriter, r *http.Request) {
+	if a.Config.MaxBodyBytes > 0 && r.Body != nil && r.Body != http.NoBody {
+		r.Body = http.MaxBytesReader(w, r.Body, a.Config.MaxBodyBytes)
+	}
+}
@@ -0,0 +1,458 @@
+package expresso
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// CBORMediaType is the media type of CBOR responses.
+const CBORMediaType = "application/cbor"
+
+// CBOR major types, see RFC 8949 section 3.1.
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborBytes  = 2 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborTag    = 6 << 5
+	cborSimple = 7 << 5
+)
+
+// cborBreak ends indefinite-length items.
+const cborBreak = 0xff
+
+// MarshalCBOR encodes v as CBOR (RFC 8949). Structs are encoded as maps keyed by their "json" tag
+// names, so CBOR clients see the same fields as JSON clients; time.Time values are encoded as RFC 3339
+// strings with tag 0 and encoding.TextMarshaler values as strings.
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	e := &cborEncoder{}
+	if err := encodeValue(e, reflect.ValueOf(v)); err != nil {
+		return nil, fmt.Errorf("expresso: cbor: %w", err)
+	}
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalCBOR decodes CBOR data into v, which must be a non-nil pointer. Fields are matched by their
+// "json" tag names, see MarshalCBOR. Indefinite-length items, half-precision floats, date/time tags 0
+// and 1 and bignums fitting 64 bits are supported; other tags decode as their content.
+func UnmarshalCBOR(data []byte, v interface{}) error {
+	return decodeCBOR(bytes.NewReader(data), v)
+}
+
+// decodeCBOR reads a single CBOR data item from r into v, rejecting any data that follows it.
+func decodeCBOR(r io.Reader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("expresso: cbor: decode target must be a non-nil pointer, got %T", v)
+	}
+	d := &cborDecoder{r: bufio.NewReader(r)}
+	if _, err := d.r.Peek(1); errors.Is(err, io.EOF) {
+		return fmt.Errorf("expresso: cbor: %w", err) // An empty document, rather than a truncated one.
+	}
+	src, err := d.decode(0)
+	if err != nil {
+		return err
+	}
+	if src == cborBreakMarker {
+		return cborError(errors.New("unexpected break"))
+	}
+	if _, err := d.r.Peek(1); !errors.Is(err, io.EOF) {
+		if err == nil {
+			err = errors.New("unexpected data after top-level value")
+		}
+		return cborError(err)
+	}
+	return assignValue(rv.Elem(), src, "")
+}
+
+// cborEncoder writes CBOR, using the shortest head for each value.
+type cborEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *cborEncoder) encodeNil() { e.buf.WriteByte(cborSimple | 22) }
+
+func (e *cborEncoder) encodeBool(b bool) {
+	if b {
+		e.buf.WriteByte(cborSimple | 21)
+	} else {
+		e.buf.WriteByte(cborSimple | 20)
+	}
+}
+
+func (e *cborEncoder) encodeInt(i int64) {
+	if i >= 0 {
+		e.writeHead(cborUint, uint64(i))
+	} else {
+		e.writeHead(cborNegInt, uint64(^i))
+	}
+}
+
+func (e *cborEncoder) encodeUint(u uint64) { e.writeHead(cborUint, u) }
+
+func (e *cborEncoder) encodeFloat32(f float32) {
+	e.buf.WriteByte(cborSimple | 26)
+	e.buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(f)))
+}
+
+func (e *cborEncoder) encodeFloat64(f float64) {
+	e.buf.WriteByte(cborSimple | 27)
+	e.buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+func (e *cborEncoder) encodeString(s string) {
+	e.writeHead(cborText, uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *cborEncoder) encodeBytes(b []byte) {
+	e.writeHead(cborBytes, uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *cborEncoder) encodeArrayLen(n int) { e.writeHead(cborArray, uint64(n)) }
+
+func (e *cborEncoder) encodeMapLen(n int) { e.writeHead(cborMap, uint64(n)) }
+
+// encodeTime writes a standard date/time string, tag 0.
+func (e *cborEncoder) encodeTime(t time.Time) {
+	e.writeHead(cborTag, 0)
+	e.encodeString(t.Format(time.RFC3339Nano))
+}
+
+// writeHead writes the initial byte of an item of the major type with its argument.
+func (e *cborEncoder) writeHead(major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		e.buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		e.buf.Write([]byte{major | 24, byte(arg)})
+	case arg <= math.MaxUint16:
+		e.buf.WriteByte(major | 25)
+		e.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(arg)))
+	case arg <= math.MaxUint32:
+		e.buf.WriteByte(major | 26)
+		e.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(arg)))
+	default:
+		e.buf.WriteByte(major | 27)
+		e.buf.Write(binary.BigEndian.AppendUint64(nil, arg))
+	}
+}
+
+// cborBreakMarker is returned by cborDecoder.decode for the break stop code, which is only valid
+// inside indefinite-length items.
+var cborBreakMarker = &struct{ name string }{"break"}
+
+// cborDecoder reads CBOR data items into generic values, see assignValue.
+type cborDecoder struct {
+	r *bufio.Reader
+}
+
+// decode reads the next data item.
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, cborError(errDecodeDepth)
+	}
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return nil, cborError(err)
+	}
+	if c == cborBreak {
+		return cborBreakMarker, nil
+	}
+	major, info := c&0xe0, c&0x1f
+
+	if major == cborSimple {
+		return d.decodeSimple(info)
+	}
+	if info == 31 {
+		return d.decodeIndefinite(major, depth)
+	}
+	arg, err := d.readArg(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		if arg <= math.MaxInt64 {
+			return int64(arg), nil
+		}
+		return arg, nil
+	case cborNegInt:
+		if arg <= math.MaxInt64 {
+			return ^int64(arg), nil
+		}
+		return nil, cborError(errors.New("negative integer overflows int64"))
+	case cborBytes:
+		return d.readBytes(arg)
+	case cborText:
+		b, err := d.readBytes(arg)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case cborArray:
+		if arg > math.MaxInt32 {
+			return nil, cborError(errors.New("array too long"))
+		}
+		items := make([]interface{}, 0, minInt(int(arg), maxPrealloc))
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.decodeItem(depth)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case cborMap:
+		if arg > math.MaxInt32 {
+			return nil, cborError(errors.New("map too long"))
+		}
+		keys := make([]interface{}, 0, minInt(int(arg), maxPrealloc))
+		values := make([]interface{}, 0, minInt(int(arg), maxPrealloc))
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decodeItem(depth)
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.decodeItem(depth)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		return d.newMap(keys, values)
+	default: // cborTag
+		return d.decodeTag(arg, depth)
+	}
+}
+
+// decodeItem reads a nested data item, rejecting a misplaced break.
+func (d *cborDecoder) decodeItem(depth int) (interface{}, error) {
+	item, err := d.decode(depth + 1)
+	if err == nil && item == cborBreakMarker {
+		return nil, cborError(errors.New("unexpected break"))
+	}
+	return item, err
+}
+
+// decodeIndefinite reads an indefinite-length item, whose elements run until a break.
+func (d *cborDecoder) decodeIndefinite(major byte, depth int) (interface{}, error) {
+	var items []interface{}
+	for {
+		item, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if item == cborBreakMarker {
+			break
+		}
+		items = append(items, item)
+	}
+
+	switch major {
+	case cborBytes, cborText:
+		// Chunks must be definite-length strings of the same major type.
+		var buf bytes.Buffer
+		for _, chunk := range items {
+			switch chunk := chunk.(type) {
+			case []byte:
+				if major != cborBytes {
+					return nil, cborError(errors.New("invalid text string chunk"))
+				}
+				buf.Write(chunk)
+			case string:
+				if major != cborText {
+					return nil, cborError(errors.New("invalid byte string chunk"))
+				}
+				buf.WriteString(chunk)
+			default:
+				return nil, cborError(errors.New("invalid string chunk"))
+			}
+		}
+		if major == cborText {
+			return buf.String(), nil
+		}
+		return buf.Bytes(), nil
+	case cborArray:
+		if items == nil {
+			items = []interface{}{}
+		}
+		return items, nil
+	case cborMap:
+		if len(items)%2 != 0 {
+			return nil, cborError(errors.New("map has a key without a value"))
+		}
+		keys := make([]interface{}, 0, len(items)/2)
+		values := make([]interface{}, 0, len(items)/2)
+		for i := 0; i < len(items); i += 2 {
+			keys = append(keys, items[i])
+			values = append(values, items[i+1])
+		}
+		return d.newMap(keys, values)
+	}
+	return nil, cborError(fmt.Errorf("invalid indefinite length for major type %d", major>>5))
+}
+
+// decodeSimple reads a simple value or float.
+func (d *cborDecoder) decodeSimple(info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23: // null, undefined
+		return nil, nil
+	case 25:
+		u, err := d.readUint(2)
+		return halfToFloat64(uint16(u)), err
+	case 26:
+		u, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 27:
+		u, err := d.readUint(8)
+		return math.Float64frombits(u), err
+	}
+	return nil, cborError(fmt.Errorf("unsupported simple value %d", info))
+}
+
+// decodeTag reads the content of a tag, converting date/times and bignums.
+func (d *cborDecoder) decodeTag(tag uint64, depth int) (interface{}, error) {
+	content, err := d.decodeItem(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case 0: // Standard date/time string.
+		s, ok := content.(string)
+		if !ok {
+			return nil, cborError(errors.New("tag 0 requires a text string"))
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, cborError(err)
+		}
+		return t, nil
+	case 1: // Epoch-based date/time.
+		switch content := content.(type) {
+		case int64:
+			return time.Unix(content, 0).UTC(), nil
+		case float64:
+			sec, frac := math.Modf(content)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+		}
+		return nil, cborError(errors.New("tag 1 requires a number"))
+	case 2, 3: // Unsigned and negative bignums.
+		b, ok := content.([]byte)
+		if !ok {
+			return nil, cborError(fmt.Errorf("tag %d requires a byte string", tag))
+		}
+		n := new(big.Int).SetBytes(b)
+		if tag == 3 {
+			n.Not(n) // -1 - n
+		}
+		switch {
+		case n.IsInt64():
+			return n.Int64(), nil
+		case n.IsUint64():
+			return n.Uint64(), nil
+		}
+		return nil, cborError(errors.New("bignum overflows 64 bits"))
+	}
+	return content, nil
+}
+
+// newMap builds a decoded map, see newDecodedMap.
+func (d *cborDecoder) newMap(keys, values []interface{}) (interface{}, error) {
+	m, err := newDecodedMap(keys, values)
+	if err != nil {
+		return nil, cborError(err)
+	}
+	return m, nil
+}
+
+// readArg reads the argument following an initial byte with additional information info.
+func (d *cborDecoder) readArg(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info <= 27:
+		return d.readUint(1 << (info - 24))
+	}
+	return 0, cborError(fmt.Errorf("invalid additional information %d", info))
+}
+
+// readUint reads a big-endian unsigned integer of n bytes.
+func (d *cborDecoder) readUint(n int) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(d.r, b[:n]); err != nil {
+		return 0, cborError(err)
+	}
+	var u uint64
+	for _, c := range b[:n] {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// readBytes reads n bytes, growing the buffer as data arrives rather than trusting n up front.
+func (d *cborDecoder) readBytes(n uint64) ([]byte, error) {
+	if n > math.MaxInt64 {
+		return nil, cborError(errors.New("string too long"))
+	}
+	var buf bytes.Buffer
+	buf.Grow(int(min(n, 64<<10)))
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		return nil, cborError(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// halfToFloat64 converts an IEEE 754 half-precision float.
+func halfToFloat64(h uint16) float64 {
+	sign, exp, frac := h>>15, int(h>>10)&0x1f, float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(frac+1024, exp-25)
+	}
+	if sign != 0 {
+		f = -f
+	}
+	return f
+}
+
+// cborError prefixes decoding errors, turning a premature end of input into io.ErrUnexpectedEOF.
+// Errors limiting the request body are returned as is, so Bind can reply 413.
+func cborError(err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return err
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("expresso: cbor: %w", err)
+}
@@ -0,0 +1,281 @@
+package expresso
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCBORRoundTrip(t *testing.T) {
+	in := sampleRecord()
+	in.Secret = "dropped"
+	data, err := MarshalCBOR(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out codecRecord
+	if err := UnmarshalCBOR(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Secret = ""
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", out, in)
+	}
+
+	var generic map[string]interface{}
+	if err := UnmarshalCBOR(data, &generic); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"name", "big", "nested", "created", "addr", "Untagged"} {
+		if _, ok := generic[key]; !ok {
+			t.Errorf("encoded map lacks key %q", key)
+		}
+	}
+	for _, key := range []string{"Secret", "-", "extra", "Name"} {
+		if _, ok := generic[key]; ok {
+			t.Errorf("encoded map has unexpected key %q", key)
+		}
+	}
+}
+
+func TestCBORTime(t *testing.T) {
+	in := time.Date(2013, 3, 21, 20, 4, 0, 500, time.FixedZone("", 2*60*60))
+	data, err := MarshalCBOR(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != 0xc0 {
+		t.Errorf("encoded as % x, want tag 0", data)
+	}
+	var out time.Time
+	if err := UnmarshalCBOR(data, &out); err != nil || !out.Equal(in) {
+		t.Errorf("decoded %v (%v), want %v", out, err, in)
+	}
+
+	// Vectors from RFC 8949 appendix A, decoded into time.Time and into a struct field.
+	vectors := []struct {
+		data string
+		want time.Time
+	}{
+		{"c0 74 323031332d30332d32315432303a30343a30305a", time.Unix(1363896240, 0)},
+		{"c1 1a 514b67b0", time.Unix(1363896240, 0)},
+		{"c1 fb 41d452d9ec200000", time.Unix(1363896240, 5e8)},
+	}
+	for _, v := range vectors {
+		var got time.Time
+		if err := UnmarshalCBOR(mustHex(t, v.data), &got); err != nil || !got.Equal(v.want) {
+			t.Errorf("% s: decoded %v (%v), want %v", v.data, got, err, v.want)
+		}
+
+		var rec codecRecord
+		data := append(mustHex(t, "a1 67 63726561746564"), mustHex(t, v.data)...) // {"created": ...}
+		if err := UnmarshalCBOR(data, &rec); err != nil || !rec.Created.Equal(v.want) {
+			t.Errorf("% s in a struct: decoded %v (%v), want %v", v.data, rec.Created, err, v.want)
+		}
+	}
+}
+
+func TestCBORVectors(t *testing.T) {
+	// Vectors from RFC 8949 appendix A.
+	tests := []struct {
+		data string
+		want interface{}
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"18 18", int64(24)},
+		{"19 03e8", int64(1000)},
+		{"1b 000000e8d4a51000", int64(1000000000000)},
+		{"1b ffffffffffffffff", uint64(math.MaxUint64)},
+		{"20", int64(-1)},
+		{"38 63", int64(-100)},
+		{"3b 7fffffffffffffff", int64(math.MinInt64)},
+		{"fa 47c35000", 100000.0},
+		{"fb 3ff199999999999a", 1.1},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"f7", nil},
+		{"40", []byte{}},
+		{"44 01020304", []byte{1, 2, 3, 4}},
+		{"60", ""},
+		{"64 49455446", "IETF"},
+		{"62 225c", `"\`},
+		{"63 e6b0b4", "水"},
+		{"80", []interface{}{}},
+		{"83 01 02 03", []interface{}{int64(1), int64(2), int64(3)}},
+		{"83 01 82 02 03 82 04 05", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{"a2 01 02 03 04", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+		{"a2 61 61 01 61 62 82 02 03", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		// Tags other than date/times and bignums decode as their content.
+		{"d8 20 76 687474703a2f2f7777772e6578616d706c652e636f6d", "http://www.example.com"},
+		{"d7 44 01020304", []byte{1, 2, 3, 4}},
+		// Bignums fitting 64 bits.
+		{"c2 41 01", int64(1)},
+		{"c2 48 ffffffffffffffff", uint64(math.MaxUint64)},
+		{"c3 41 00", int64(-1)},
+		{"c3 48 7fffffffffffffff", int64(math.MinInt64)},
+		// Indefinite-length items.
+		{"5f 42 0102 43 030405 ff", []byte{1, 2, 3, 4, 5}},
+		{"5f ff", []byte{}},
+		{"7f 65 7374726561 64 6d696e67 ff", "streaming"},
+		{"9f ff", []interface{}{}},
+		{"9f 01 82 02 03 9f 04 05 ff ff", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{"83 01 9f 02 03 ff 82 04 05", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{"bf 61 61 01 61 62 9f 02 03 ff ff", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{"bf 63 46756e f5 63 416d74 21 ff", map[string]interface{}{"Fun": true, "Amt": int64(-2)}},
+	}
+	for _, tt := range tests {
+		var got interface{}
+		if err := UnmarshalCBOR(mustHex(t, tt.data), &got); err != nil {
+			t.Errorf("% s: %v", tt.data, err)
+			continue
+		}
+		if b, ok := got.([]byte); ok && len(b) == 0 {
+			got = []byte{} // Empty byte strings may decode as nil or empty.
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("% s: decoded %#v, want %#v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestCBORHalfFloats(t *testing.T) {
+	// Vectors from RFC 8949 appendix A.
+	tests := []struct {
+		data string
+		want float64
+	}{
+		{"f9 0000", 0},
+		{"f9 8000", math.Copysign(0, -1)},
+		{"f9 3c00", 1},
+		{"f9 3e00", 1.5},
+		{"f9 7bff", 65504},
+		{"f9 0001", 5.960464477539063e-8},
+		{"f9 0400", 0.00006103515625},
+		{"f9 c400", -4},
+		{"f9 7c00", math.Inf(1)},
+		{"f9 fc00", math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		var got float64
+		if err := UnmarshalCBOR(mustHex(t, tt.data), &got); err != nil {
+			t.Errorf("% s: %v", tt.data, err)
+			continue
+		}
+		if got != tt.want || math.Signbit(got) != math.Signbit(tt.want) {
+			t.Errorf("% s: decoded %v, want %v", tt.data, got, tt.want)
+		}
+	}
+
+	var nan float64
+	if err := UnmarshalCBOR(mustHex(t, "f9 7e00"), &nan); err != nil || !math.IsNaN(nan) {
+		t.Errorf("f9 7e00: decoded %v (%v), want NaN", nan, err)
+	}
+}
+
+func TestCBORMalformed(t *testing.T) {
+	valid, err := MarshalCBOR(sampleRecord())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 1; n < len(valid); n++ {
+		var out codecRecord
+		if err := UnmarshalCBOR(valid[:n], &out); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("truncated to %d of %d bytes: error = %v, want io.ErrUnexpectedEOF", n, len(valid), err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "EOF"},
+		{"trailing data", mustHex(t, "01 02"), "unexpected data after top-level value"},
+		{"truncated indefinite array", mustHex(t, "9f 01 02"), "unexpected EOF"},
+		{"depth limit", append(bytes.Repeat([]byte{0x81}, maxDecodeDepth+1), 0xf6), "nested too deeply"},
+		{"indefinite depth limit", bytes.Repeat([]byte{0x9f}, maxDecodeDepth+2), "nested too deeply"},
+		{"tag depth limit", append(bytes.Repeat([]byte{0xd8, 0x20}, maxDecodeDepth+1), 0xf6), "nested too deeply"},
+		{"huge string", mustHex(t, "7a ffffffff 61"), "unexpected EOF"},
+		{"huge 64-bit string", mustHex(t, "7b ffffffffffffffff 61"), "string too long"},
+		{"huge byte string", mustHex(t, "5b 00000000ffffffff 61"), "unexpected EOF"},
+		{"huge array", mustHex(t, "9a 7fffffff 01"), "unexpected EOF"},
+		{"huge 32-bit array", mustHex(t, "9a ffffffff 01"), "array too long"},
+		{"huge 64-bit array", mustHex(t, "9b ffffffffffffffff 01"), "array too long"},
+		{"huge map", mustHex(t, "ba 7fffffff 01 01"), "unexpected EOF"},
+		{"huge 64-bit map", mustHex(t, "bb ffffffffffffffff 01 01"), "map too long"},
+		{"lone break", mustHex(t, "ff"), "unexpected break"},
+		{"break in a definite array", mustHex(t, "82 01 ff"), "unexpected break"},
+		{"break as a map value", mustHex(t, "bf 01 ff"), "key without a value"},
+		{"text chunk in a byte string", mustHex(t, "5f 61 61 ff"), "invalid byte string chunk"},
+		{"byte chunk in a text string", mustHex(t, "7f 41 61 ff"), "invalid text string chunk"},
+		{"array chunk in a text string", mustHex(t, "7f 80 ff"), "invalid string chunk"},
+		{"indefinite integer", mustHex(t, "1f ff"), "invalid indefinite length"},
+		{"reserved additional information", mustHex(t, "1c"), "invalid additional information 28"},
+		{"unsupported simple value", mustHex(t, "e0"), "unsupported simple value 0"},
+		{"negative integer overflow", mustHex(t, "3b ffffffffffffffff"), "overflows int64"},
+		{"bignum overflow", mustHex(t, "c2 49 010000000000000000"), "bignum overflows 64 bits"},
+		{"negative bignum overflow", mustHex(t, "c3 48 ffffffffffffffff"), "bignum overflows 64 bits"},
+		{"bignum of a number", mustHex(t, "c2 01"), "tag 2 requires a byte string"},
+		{"tag 0 of a number", mustHex(t, "c0 01"), "tag 0 requires a text string"},
+		{"tag 0 of an invalid date", mustHex(t, "c0 63 616263"), "cannot parse"},
+		{"tag 1 of a string", mustHex(t, "c1 61 61"), "tag 1 requires a number"},
+		{"unhashable key", mustHex(t, "a1 80 01"), "unsupported map key"},
+	}
+	for _, tt := range tests {
+		var out interface{}
+		err := UnmarshalCBOR(tt.data, &out)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestBindCBOR(t *testing.T) {
+	app := newTestApp()
+	var got codecRecord
+	app.POST("/", func(ctx *Context) {
+		got = codecRecord{}
+		if err := ctx.Bind(&got); err != nil {
+			ctx.Fail(err)
+			return
+		}
+		ctx.SendStatus(http.StatusNoContent)
+	})
+
+	want := sampleRecord()
+	valid, _ := MarshalCBOR(want)
+	wrongType, _ := MarshalCBOR(map[string]interface{}{"count": "many"})
+	tests := []struct {
+		name string
+		body []byte
+		code int
+		msg  string
+	}{
+		{"valid", valid, http.StatusNoContent, ""},
+		{"empty", nil, http.StatusBadRequest, "malformed CBOR body: empty body"},
+		{"truncated", valid[:len(valid)/2], http.StatusBadRequest, "malformed CBOR body"},
+		{"trailing data", append(valid[:len(valid):len(valid)], 0xf6), http.StatusBadRequest, "unexpected data after top-level value"},
+		{"wrong type", wrongType, http.StatusBadRequest, `invalid CBOR field \"count\"`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(tt.body))
+		req.Header.Set("Content-Type", CBORMediaType)
+		w := serve(app, req)
+		if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.msg) {
+			t.Errorf("%s: response = %d %s, want %d containing %q", tt.name, w.Code, w.Body.String(), tt.code, tt.msg)
+		}
+		if tt.code == http.StatusNoContent && !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: bound %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
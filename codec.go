@@ -0,0 +1,552 @@
+package expresso
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDecodeDepth bounds the nesting of decoded binary documents, protecting the stack from hostile input.
+const maxDecodeDepth = 1000
+
+// maxPrealloc bounds the capacity allocated up front for decoded arrays and maps, whose length
+// prefix comes from untrusted input; longer collections grow as their elements are read.
+const maxPrealloc = 1024
+
+// errDecodeDepth is returned for documents nested deeper than maxDecodeDepth.
+var errDecodeDepth = errors.New("document nested too deeply")
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// binaryEncoder writes the data model shared by MessagePack and CBOR, see encodeValue.
+type binaryEncoder interface {
+	encodeNil()
+	encodeBool(b bool)
+	encodeInt(i int64)
+	encodeUint(u uint64)
+	encodeFloat32(f float32)
+	encodeFloat64(f float64)
+	encodeString(s string)
+	encodeBytes(b []byte)
+	encodeTime(t time.Time)
+	encodeArrayLen(n int)
+	encodeMapLen(n int)
+}
+
+// encodeValue walks v and writes it with e. Structs are encoded as maps keyed by their "json" tag
+// names, honouring "-" and omitempty, so the binary formats share the field names of the JSON API.
+// Map keys are sorted, making the output deterministic.
+func encodeValue(e binaryEncoder, v reflect.Value) error {
+	if !v.IsValid() {
+		e.encodeNil()
+		return nil
+	}
+
+	if v.Type() == timeType {
+		e.encodeTime(v.Interface().(time.Time))
+		return nil
+	}
+	if v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface && v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		e.encodeString(string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			e.encodeNil()
+			return nil
+		}
+		return encodeValue(e, v.Elem())
+	case reflect.Bool:
+		e.encodeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.encodeFloat32(float32(v.Float()))
+	case reflect.Float64:
+		e.encodeFloat64(v.Float())
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.encodeNil()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.encodeBytes(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		e.encodeArrayLen(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeValue(e, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.encodeNil()
+			return nil
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		e.encodeMapLen(len(keys))
+		for _, key := range keys {
+			if err := encodeValue(e, key); err != nil {
+				return err
+			}
+			if err := encodeValue(e, v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := structFields(v)
+		e.encodeMapLen(len(fields))
+		for _, f := range fields {
+			e.encodeString(f.name)
+			if err := encodeValue(e, f.value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// codecField is a struct field to encode, with its "json" tag name.
+type codecField struct {
+	name  string
+	value reflect.Value
+}
+
+// structFields returns the exported fields of a struct to encode, flattening embedded structs
+// without a tag name and skipping fields tagged "-" or empty fields tagged omitempty.
+func structFields(v reflect.Value) []codecField {
+	var fields []codecField
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, omitEmpty, skip := jsonFieldName(sf)
+		if skip {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && name == "" {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				fields = append(fields, structFields(fv)...)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		fields = append(fields, codecField{name, fv})
+	}
+	return fields
+}
+
+// jsonFieldName returns the name given to a struct field by its "json" tag, whether it has the
+// omitempty option, and whether the field is excluded with "-".
+func jsonFieldName(sf reflect.StructField) (name string, omitEmpty, skip bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty, false
+}
+
+// codecTypeError describes a decoded value that cannot be stored in the target field.
+type codecTypeError struct {
+	field string       // The dotted path of the field, empty for the top-level value.
+	want  reflect.Type // The type of the target.
+	got   string       // A description of the decoded value.
+}
+
+// Error describes the mismatch.
+func (e *codecTypeError) Error() string {
+	if e.field == "" {
+		return fmt.Sprintf("cannot decode %s into %s", e.got, e.want)
+	}
+	return fmt.Sprintf("field %q: cannot decode %s into %s", e.field, e.got, e.want)
+}
+
+// assignValue stores a decoded value, as produced by the MessagePack and CBOR decoders, in dst,
+// converting between numeric types where no precision is lost. Map keys are matched to struct
+// fields by their "json" tag names, case-insensitively as encoding/json does; unknown keys are ignored.
+func assignValue(dst reflect.Value, src interface{}, path string) error {
+	if dst.Kind() == reflect.Pointer {
+		if src == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assignValue(dst.Elem(), src, path)
+	}
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		if src == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+		} else {
+			dst.Set(reflect.ValueOf(src))
+		}
+		return nil
+	}
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	mismatch := &codecTypeError{field: path, want: dst.Type(), got: describeDecoded(src)}
+
+	if dst.Type() == timeType {
+		switch src := src.(type) {
+		case time.Time:
+			dst.Set(reflect.ValueOf(src))
+			return nil
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, src)
+			if err != nil {
+				return mismatch
+			}
+			dst.Set(reflect.ValueOf(t))
+			return nil
+		}
+		return mismatch
+	}
+	if s, ok := src.(string); ok && dst.CanAddr() {
+		if u, ok := dst.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := u.UnmarshalText([]byte(s)); err != nil {
+				return &codecTypeError{field: path, want: dst.Type(), got: strconv.Quote(s)}
+			}
+			return nil
+		}
+	}
+
+	switch dst.Kind() {
+	case reflect.Bool:
+		b, ok := src.(bool)
+		if !ok {
+			return mismatch
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch n := src.(type) {
+		case int64:
+			i = n
+		case uint64:
+			if n > 1<<63-1 {
+				return mismatch
+			}
+			i = int64(n)
+		case float64:
+			if n != float64(int64(n)) {
+				return mismatch
+			}
+			i = int64(n)
+		default:
+			return mismatch
+		}
+		if dst.OverflowInt(i) {
+			return mismatch
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch n := src.(type) {
+		case int64:
+			if n < 0 {
+				return mismatch
+			}
+			u = uint64(n)
+		case uint64:
+			u = n
+		case float64:
+			if n < 0 || n != float64(uint64(n)) {
+				return mismatch
+			}
+			u = uint64(n)
+		default:
+			return mismatch
+		}
+		if dst.OverflowUint(u) {
+			return mismatch
+		}
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch n := src.(type) {
+		case float64:
+			dst.SetFloat(n)
+		case int64:
+			dst.SetFloat(float64(n))
+		case uint64:
+			dst.SetFloat(float64(n))
+		default:
+			return mismatch
+		}
+	case reflect.String:
+		switch s := src.(type) {
+		case string:
+			dst.SetString(s)
+		case []byte:
+			dst.SetString(string(s))
+		default:
+			return mismatch
+		}
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			switch b := src.(type) {
+			case []byte:
+				dst.SetBytes(append([]byte(nil), b...))
+				return nil
+			case string:
+				dst.SetBytes([]byte(b))
+				return nil
+			}
+		}
+		items, ok := src.([]interface{})
+		if !ok {
+			return mismatch
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assignValue(slice.Index(i), item, indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+	case reflect.Array:
+		items, ok := src.([]interface{})
+		if !ok {
+			return mismatch
+		}
+		for i := 0; i < dst.Len(); i++ {
+			if i < len(items) {
+				if err := assignValue(dst.Index(i), items[i], indexPath(path, i)); err != nil {
+					return err
+				}
+			} else {
+				dst.Index(i).Set(reflect.Zero(dst.Type().Elem()))
+			}
+		}
+	case reflect.Map:
+		entries, ok := decodedEntries(src)
+		if !ok {
+			return mismatch
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), len(entries))
+		for _, entry := range entries {
+			key := reflect.New(dst.Type().Key()).Elem()
+			if err := assignValue(key, entry.key, path); err != nil {
+				return err
+			}
+			value := reflect.New(dst.Type().Elem()).Elem()
+			if err := assignValue(value, entry.value, fieldPath(path, fmt.Sprint(entry.key))); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		entries, ok := decodedEntries(src)
+		if !ok {
+			return mismatch
+		}
+		for _, entry := range entries {
+			name, ok := entry.key.(string)
+			if !ok {
+				continue
+			}
+			field, ok := fieldByName(dst, name)
+			if !ok {
+				continue
+			}
+			if err := assignValue(field, entry.value, fieldPath(path, name)); err != nil {
+				return err
+			}
+		}
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+// decodedEntry is a key/value pair of a decoded map.
+type decodedEntry struct {
+	key, value interface{}
+}
+
+// decodedEntries returns the entries of a decoded map, or false if src is not a map.
+func decodedEntries(src interface{}) ([]decodedEntry, bool) {
+	switch m := src.(type) {
+	case map[string]interface{}:
+		entries := make([]decodedEntry, 0, len(m))
+		for k, v := range m {
+			entries = append(entries, decodedEntry{k, v})
+		}
+		return entries, true
+	case map[interface{}]interface{}:
+		entries := make([]decodedEntry, 0, len(m))
+		for k, v := range m {
+			entries = append(entries, decodedEntry{k, v})
+		}
+		return entries, true
+	}
+	return nil, false
+}
+
+// newDecodedMap returns the generic map for a decoded map: keyed by string if every key is a string,
+// as encoding/json produces for interface{} targets, and by interface{} otherwise.
+func newDecodedMap(keys, values []interface{}) (interface{}, error) {
+	stringKeys := true
+	for _, k := range keys {
+		if _, ok := k.(string); !ok {
+			stringKeys = false
+			break
+		}
+	}
+	if stringKeys {
+		m := make(map[string]interface{}, len(keys))
+		for i, k := range keys {
+			m[k.(string)] = values[i]
+		}
+		return m, nil
+	}
+
+	m := make(map[interface{}]interface{}, len(keys))
+	for i, k := range keys {
+		if k != nil && !reflect.TypeOf(k).Comparable() {
+			return nil, fmt.Errorf("unsupported map key of type %T", k)
+		}
+		m[k] = values[i]
+	}
+	return m, nil
+}
+
+// fieldByName returns the struct field, possibly of an embedded struct, whose "json" tag name
+// or Go name matches name, preferring an exact match over a case-insensitive one.
+func fieldByName(v reflect.Value, name string) (reflect.Value, bool) {
+	var fold reflect.Value
+	found := false
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tagName, _, skip := jsonFieldName(sf)
+		if skip {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && tagName == "" {
+			if fv.Kind() == reflect.Pointer && fv.Type().Elem().Kind() == reflect.Struct {
+				if fv.IsNil() {
+					if !fv.CanSet() {
+						continue
+					}
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if f, ok := fieldByName(fv, name); ok {
+					return f, true
+				}
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if tagName == "" {
+			tagName = sf.Name
+		}
+		if tagName == name {
+			return fv, true
+		}
+		if !found && strings.EqualFold(tagName, name) {
+			fold, found = fv, true
+		}
+	}
+	return fold, found
+}
+
+// describeDecoded describes a decoded value for error messages.
+func describeDecoded(src interface{}) string {
+	switch src.(type) {
+	case bool:
+		return "boolean"
+	case int64, uint64:
+		return "integer"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []byte:
+		return "binary data"
+	case time.Time:
+		return "timestamp"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}, map[interface{}]interface{}:
+		return "map"
+	}
+	return fmt.Sprintf("%T", src)
+}
+
+// fieldPath appends a field name to a dotted path.
+func fieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// indexPath appends an index to a path, e.g. "tags[2]".
+func indexPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// minInt returns the smaller of a and b.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
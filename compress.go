@@ -0,0 +1,378 @@
+package expresso
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressMinSize is the smallest body, in bytes, compressed when CompressOptions.MinSize is zero.
+const DefaultCompressMinSize = 1024
+
+// Encoder creates a writer compressing to w with a content coding, e.g. "gzip", at the given level.
+// The meaning of the level is up to the encoder; zero requests its default.
+type Encoder func(w io.Writer, level int) (io.WriteCloser, error)
+
+// encoders is the registry of content codings available to the compression middleware, in order of preference.
+var encoders = struct {
+	sync.RWMutex
+	names  []string
+	byName map[string]Encoder
+}{
+	names: []string{"gzip", "deflate"},
+	byName: map[string]Encoder{
+		"gzip": func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				level = gzip.DefaultCompression
+			}
+			return gzip.NewWriterLevel(w, level)
+		},
+		// The HTTP deflate coding is the zlib format, not raw DEFLATE, see RFC 9110 section 8.4.1.2.
+		"deflate": func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				level = zlib.DefaultCompression
+			}
+			return zlib.NewWriterLevel(w, level)
+		},
+	},
+}
+
+// RegisterEncoder makes a content coding available to the compression middleware, replacing any
+// encoder registered for it. "gzip" and "deflate" are registered by default; other codings, such as
+// "br" or "zstd", can be added with encoders from third-party packages:
+//
+//	expresso.RegisterEncoder("br", func(w io.Writer, level int) (io.WriteCloser, error) {
+//		return brotli.NewWriterLevel(w, level), nil
+//	})
+func RegisterEncoder(coding string, encoder Encoder) {
+	coding = strings.ToLower(coding)
+	encoders.Lock()
+	defer encoders.Unlock()
+	if _, ok := encoders.byName[coding]; !ok {
+		encoders.names = append(encoders.names, coding)
+	}
+	encoders.byName[coding] = encoder
+}
+
+// lookupEncoder returns the encoder registered for coding, or nil.
+func lookupEncoder(coding string) Encoder {
+	encoders.RLock()
+	defer encoders.RUnlock()
+	return encoders.byName[coding]
+}
+
+// CompressOptions configures the middleware returned by NewCompressMiddleware.
+type CompressOptions struct {
+	// Level is passed to the encoder; for gzip and deflate it ranges from flate.BestSpeed to
+	// flate.BestCompression. Zero uses the encoder's default level.
+	Level int
+	// MinSize is the smallest body, in bytes, worth compressing, DefaultCompressMinSize if zero.
+	// Streamed responses, which call Flush, are compressed regardless of their size.
+	MinSize int
+	// SkipTypes lists media types that are never compressed, either exact, such as "application/zip",
+	// or a type wildcard, such as "video/*". Defaults to common already-compressed formats.
+	SkipTypes []string
+	// Encodings lists the content codings offered, in order of preference when the client accepts
+	// several with the same q-value. Defaults to every registered coding, gzip and deflate first.
+	Encodings []string
+}
+
+// defaultSkipTypes are media types whose content is already compressed.
+var defaultSkipTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif", "video/*", "audio/*",
+	"font/woff", "font/woff2", "application/zip", "application/gzip", "application/x-gzip",
+	"application/zstd", "application/x-bzip2", "application/x-xz", "application/x-7z-compressed",
+	"application/x-rar-compressed", "application/wasm",
+}
+
+// NewCompressMiddleware returns a middleware compressing response bodies with the best content coding
+// accepted by the client, according to the q-values of its Accept-Encoding header. Register it with App.Use.
+//
+// The body is buffered until MinSize bytes have been written, so small responses are sent uncompressed.
+// Responses with a Content-Encoding or Content-Range, with a media type listed in SkipTypes, or to HEAD
+// and upgrade requests are never compressed. Vary: Accept-Encoding is added to every other response.
+func NewCompressMiddleware(opts CompressOptions) Middleware {
+	minSize := opts.MinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressMinSize
+	}
+	skipTypes := opts.SkipTypes
+	if skipTypes == nil {
+		skipTypes = defaultSkipTypes
+	}
+
+	return func(ctx *Context) {
+		if ctx.Request.Method == http.MethodHead || ctx.Request.Headers.Get("Upgrade") != "" {
+			ctx.Next()
+			return
+		}
+
+		offers := opts.Encodings
+		if offers == nil {
+			encoders.RLock()
+			offers = append([]string(nil), encoders.names...)
+			encoders.RUnlock()
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: ctx.Response.w,
+			rec:            ctx.Response.rec,
+			coding:         negotiateEncoding(ctx.Request.Headers.Values("Accept-Encoding"), offers),
+			level:          opts.Level,
+			minSize:        minSize,
+			skipTypes:      skipTypes,
+		}
+		ctx.Response.w = cw
+		ctx.cleanups = append(ctx.cleanups, func() {
+			if err := cw.Close(); err != nil {
+				ctx.Error("compressing response: " + err.Error())
+			}
+		})
+
+		ctx.Next()
+	}
+}
+
+// negotiateEncoding returns the offered coding with the highest q-value in the Accept-Encoding
+// header values, preferring earlier offers on ties, or "" if the response should not be encoded.
+func negotiateEncoding(accept []string, offers []string) string {
+	qualities := map[string]float64{}
+	wildcard := -1.0
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			coding, q := parseQuality(part)
+			if coding == "" {
+				continue
+			}
+			if coding == "*" {
+				wildcard = q
+			} else {
+				qualities[coding] = q
+			}
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, ok := qualities[offer]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ && lookupEncoder(offer) != nil {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// parseQuality splits a header list element such as "gzip;q=0.8" into its lowercase value and
+// q-value, which defaults to 1. Invalid q-values are treated as 0.
+func parseQuality(part string) (string, float64) {
+	value, params, _ := strings.Cut(part, ";")
+	value = strings.ToLower(strings.TrimSpace(value))
+	q := 1.0
+	for _, param := range strings.Split(params, ";") {
+		name, v, ok := strings.Cut(param, "=")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			q = parsed
+		}
+	}
+	return value, q
+}
+
+// compressWriter compresses the body written through it once it is known to be worth compressing.
+// Until then the status and body are held back, see decide, while the recorder is told the status
+// right away so the response counts as written.
+type compressWriter struct {
+	http.ResponseWriter
+	rec       *responseRecorder // The request's recorder, see responseRecorder.commit.
+	coding    string            // The negotiated content coding, "" if the client accepts none.
+	level     int
+	minSize   int
+	skipTypes []string
+
+	status  int            // Status passed to WriteHeader, held back until the decision.
+	buf     []byte         // Body written before the decision.
+	decided bool           // Whether the headers were sent and the encoding chosen.
+	encoder io.WriteCloser // The compressing writer, nil if the body is sent as is.
+}
+
+// WriteHeader holds back the status until the body is known to be worth compressing, unless the
+// response cannot be compressed anyway.
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided || w.status != 0 {
+		// Send the response held back so far, then let the recorder warn about the superfluous call.
+		if !w.decided {
+			_ = w.decide(w.compressible())
+		}
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.setStatus(code)
+	if !w.compressible() {
+		_ = w.decide(false)
+	}
+}
+
+// setStatus holds back the status of the response, recording it as sent.
+func (w *compressWriter) setStatus(code int) {
+	w.status = code
+	w.rec.commit(code)
+}
+
+// Write buffers the body until MinSize bytes were written, then compresses it if possible.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.setStatus(http.StatusOK)
+	}
+	if !w.decided {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(append(w.buf, b...)))
+		}
+		if len(w.buf)+len(b) < w.minSize && w.compressible() {
+			w.buf = append(w.buf, b...)
+			return len(b), nil
+		}
+		w.buf = append(w.buf, b...)
+		if err := w.decide(w.compressible()); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends what was written so far, compressed if possible regardless of MinSize, as the response is streamed.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.setStatus(http.StatusOK)
+		}
+		if err := w.decide(w.compressible()); err != nil {
+			return
+		}
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack takes over the connection from the underlying writer.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("expresso: hijacking is not supported by the response writer")
+	}
+	w.decided = true // Nothing is written through the writer once the connection is taken over.
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for use by http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close sends a response still held back, uncompressed as it is smaller than MinSize,
+// and finishes the compressed stream.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if w.status == 0 {
+			if len(w.buf) == 0 {
+				return nil // Nothing was written; net/http sends the default response.
+			}
+			w.setStatus(http.StatusOK)
+		}
+		return w.decide(false)
+	}
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	return nil
+}
+
+// compressible reports whether the response, as far as it is known, may be compressed.
+func (w *compressWriter) compressible() bool {
+	if w.coding == "" {
+		return false
+	}
+	switch {
+	case w.status < http.StatusOK, w.status == http.StatusNoContent, w.status == http.StatusNotModified,
+		w.status == http.StatusPartialContent:
+		return false
+	}
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < w.minSize {
+		return false
+	}
+	return !w.skipped(header.Get("Content-Type"))
+}
+
+// skipped reports whether the media type of contentType is listed in SkipTypes.
+func (w *compressWriter) skipped(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, skip := range w.skipTypes {
+		if strings.HasSuffix(skip, "/*") && strings.HasPrefix(mediaType, skip[:len(skip)-1]) || mediaType == skip {
+			return true
+		}
+	}
+	return false
+}
+
+// decide sends the held back status and headers, compressing the body from now on if compress is set,
+// and writes the buffered body.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Encoding") == "" {
+		header.Add("Vary", "Accept-Encoding")
+	}
+
+	if compress {
+		enc, err := lookupEncoder(w.coding)(w.ResponseWriter, w.level)
+		if err != nil {
+			w.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+			return err
+		}
+		w.encoder = enc
+		header.Set("Content-Encoding", w.coding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
@@ -0,0 +1,176 @@
+package expresso
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newCompressApp returns an App compressing responses with opts, serving body at / with the given
+// content type. Bodies are sent as a File, which keeps the Content-Type set by the handler.
+func newCompressApp(t *testing.T, opts CompressOptions, contentType, body string) *App {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "body")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp()
+	app.Use(NewCompressMiddleware(opts))
+	app.GET("/", func(ctx *Context) {
+		ctx.Response.Headers.Set("Content-Type", contentType)
+		ctx.Send(File{Path: path})
+	})
+	app.HEAD("/", func(ctx *Context) {
+		ctx.Send(Text{Content: body})
+	})
+	return app
+}
+
+// decompress decodes a response body according to its Content-Encoding.
+func decompress(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var r io.Reader = w.Body
+	switch w.Header().Get("Content-Encoding") {
+	case "gzip":
+		gr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gr
+	case "deflate":
+		zr, err := zlib.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCompressNegotiation(t *testing.T) {
+	large := strings.Repeat("compressible text ", 200)
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip, deflate", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"GZIP;Q=0.8, deflate;q=0.2", "gzip"},
+		{"gzip;q=0", ""},
+		{"*", "gzip"},
+		{"*;q=0.1, gzip;q=0", "deflate"},
+		{"br", ""},
+		{"", ""},
+	}
+	app := newCompressApp(t, CompressOptions{}, "text/plain", large)
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		w := serve(app, req)
+		if got := w.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want %q", tt.acceptEncoding, got, tt.want)
+			continue
+		}
+		if got := decompress(t, w); got != large {
+			t.Errorf("Accept-Encoding %q: decoded body of %d bytes, want %d", tt.acceptEncoding, len(got), len(large))
+		}
+		if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+			t.Errorf("Accept-Encoding %q: Vary = %q", tt.acceptEncoding, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestCompressSkips(t *testing.T) {
+	large := strings.Repeat("x", 4096)
+	tests := []struct {
+		name        string
+		app         *App
+		method      string
+		contentType string
+	}{
+		{"small body", newCompressApp(t, CompressOptions{}, "text/plain", "small"), "GET", ""},
+		{"skipped type", newCompressApp(t, CompressOptions{}, "image/png", large), "GET", ""},
+		{"skipped wildcard", newCompressApp(t, CompressOptions{SkipTypes: []string{"text/*"}}, "text/csv", large), "GET", ""},
+		{"HEAD request", newCompressApp(t, CompressOptions{}, "text/plain", large), "HEAD", ""},
+		{"offered encodings", newCompressApp(t, CompressOptions{Encodings: []string{"deflate"}}, "text/plain", large), "GET", "gzip"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := serve(tt.app, req)
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%s: Content-Encoding = %q, want none", tt.name, got)
+		}
+	}
+}
+
+func TestCompressRecordsStatusOfHeldBackResponse(t *testing.T) {
+	var log bytes.Buffer
+	app := newTestApp()
+	// The access log is registered after compression, so its cleanup runs before the held back body is sent.
+	app.Use(NewCompressMiddleware(CompressOptions{}))
+	app.Use(NewAccessLogMiddleware(AccessLogOptions{Output: &log}))
+
+	var sent bool
+	var status int
+	app.GET("/", func(ctx *Context) {
+		ctx.Status(http.StatusCreated).Send(Text{Content: "small"})
+		sent, status = ctx.HeadersSent(), ctx.ResponseStatus()
+		ctx.Send(Text{Content: "second"}) // Ignored, as the response was already written.
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := serve(app, req)
+
+	if !sent || status != http.StatusCreated {
+		t.Errorf("after Send: HeadersSent() = %v, ResponseStatus() = %d, want true and 201", sent, status)
+	}
+	if w.Code != http.StatusCreated || w.Body.String() != "small" {
+		t.Errorf("response = %d %q, want 201 \"small\"", w.Code, w.Body.String())
+	}
+	if !strings.Contains(log.String(), `" 201 `) {
+		t.Errorf("access log = %q, want status 201", log.String())
+	}
+}
+
+func TestCompressStreaming(t *testing.T) {
+	app := newTestApp()
+	app.Use(NewCompressMiddleware(CompressOptions{}))
+	app.GET("/", func(ctx *Context) {
+		stream, err := ctx.SSE()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		stream.Event("", "", "first")
+		stream.Event("", "", "second")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := serve(app, req)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want a compressed stream despite its size", w.Header().Get("Content-Encoding"))
+	}
+	if got := decompress(t, w); got != "data: first\n\ndata: second\n\n" {
+		t.Errorf("stream = %q", got)
+	}
+}
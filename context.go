@@ -3,18 +3,62 @@ package expresso
 // Context represents the context of a request, holding the request and response objects,
 // along with additional data and control flags used during middleware processing.
 type Context struct {
-	*Request                             // Embedded request object containing details about the incoming request.
-	Response                             // Embedded response object for sending data back to the client.
-	Extras   map[interface{}]interface{} // A map for storing additional data that may be used across middlewares.
-	goNext   bool                        // A flag to control the flow of middleware execution.
-	*Logger                              // Logger for logging messages.
+	*Request                                      // Embedded request object containing details about the incoming request.
+	Response                                      // Embedded response object for sending data back to the client.
+	Extras            map[interface{}]interface{} // A map for storing additional data that may be used across middlewares.
+	goNext            bool                        // A flag to control the flow of middleware execution.
+	middlewares       []Middleware                // The middleware chain being executed for the request.
+	index             int                         // The index of the next middleware in the chain to run.
+	halted            bool                        // Set once a middleware returns without calling Next.
+	onion             bool                        // Whether Next runs the rest of the chain synchronously.
+	onError           ErrorHandler                // Handler invoked by Fail, nil for DefaultErrorHandler.
+	views             *ViewEngine                 // View engine used by Render, nil if not configured.
+	cleanups          []func()                    // Functions run in reverse order once the middleware chain has finished.
+	onPanic           PanicHandler                // Handler invoked on panics, nil for DefaultPanicHandler.
+	development       bool                        // Whether the App runs in development mode.
+	requestID         string                      // ID assigned by the request ID middleware, see RequestID.
+	uploads           UploadOptions               // Limits applied to multipart uploads, see UploadLimits.
+	strictNegotiation bool                        // Whether Formatted replies 406 when no option is acceptable.
+	renderers         *rendererRegistry           // Renderers registered with App.RegisterRenderer.
+	shutdown          <-chan struct{}             // Closed when the App starts shutting down.
+	*Logger                                       // Logger for logging messages.
 }
 
 // Next sets the goNext flag to true, allowing the next middleware in the chain to be executed.
+// In MiddlewareModeOnion, Next also runs the rest of the chain before returning.
 func (c *Context) Next() {
 	c.goNext = true
+	if c.onion {
+		c.run()
+	}
 }
 
+// Abort clears the goNext flag so the chain stops once the current middleware returns.
+// In MiddlewareModeOnion it has no effect after Next has already run the rest of the chain.
 func (c *Context) Abort() {
 	c.goNext = false
 }
+
+// run invokes the remaining middleware in the chain until one returns without calling Next.
+func (c *Context) run() {
+	for c.index < len(c.middlewares) && !c.halted {
+		middleware := c.middlewares[c.index]
+		c.index++
+		c.goNext = false
+		middleware(c)
+		if !c.goNext {
+			c.halted = true
+		}
+	}
+}
+
+// Fail stops the middleware chain and passes err to the App's error handler,
+// which writes the error response. See App.OnError.
+func (c *Context) Fail(err error) {
+	c.Abort()
+	if c.onError != nil {
+		c.onError(c, err)
+		return
+	}
+	DefaultErrorHandler(c, err)
+}
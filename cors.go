@@ -1,5 +1,15 @@
 package expresso
 
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cors holds static CORS headers for a single path, see App.CORS.
+//
+// Deprecated: Use CorsOptions with NewCorsMiddleware.
 type Cors struct {
 	Path    string
 	Origin  string
@@ -7,6 +17,9 @@ type Cors struct {
 	Methods string
 }
 
+// NewCorsHandler returns a middleware setting the static CORS headers in cors on every response.
+//
+// Deprecated: Use NewCorsMiddleware, which supports multiple origins, credentials and preflight requests.
 func NewCorsHandler(cors Cors) Middleware {
 	return func(ctx *Context) {
 		ctx.Response.Headers.Set("access-control-allow-origin", cors.Origin)
@@ -15,3 +28,112 @@ func NewCorsHandler(cors Cors) Middleware {
 		ctx.Next()
 	}
 }
+
+// CorsOptions configures the middleware returned by NewCorsMiddleware.
+type CorsOptions struct {
+	// AllowOrigins lists the allowed origins. An entry is either an exact origin such as
+	// "https://example.com", a wildcard subdomain pattern such as "https://*.example.com",
+	// or "*" to allow any origin.
+	AllowOrigins []string
+	// AllowOriginFunc, if set, is consulted for origins not matched by AllowOrigins.
+	AllowOriginFunc func(origin string) bool
+	// AllowMethods lists the methods allowed in preflight requests. Defaults to GET, HEAD, PUT, PATCH, POST and DELETE.
+	AllowMethods []string
+	// AllowHeaders lists the request headers allowed in preflight requests.
+	// If empty, the headers requested by the client are allowed.
+	AllowHeaders []string
+	// ExposeHeaders lists the response headers the browser may expose to scripts.
+	ExposeHeaders []string
+	// AllowCredentials allows requests with cookies or HTTP authentication. It cannot be combined
+	// with the "*" origin, which would let any site make credentialed requests; list the origins instead.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight results. Zero omits the header.
+	MaxAge time.Duration
+}
+
+// NewCorsMiddleware returns a middleware implementing Cross-Origin Resource Sharing. Register it with
+// App.Use so that preflight requests, which it answers with 204 No Content, are handled for every route.
+// Requests from origins that are not allowed are passed on without CORS headers, so the browser blocks them.
+// It panics if AllowCredentials is combined with the "*" origin.
+func NewCorsMiddleware(opts CorsOptions) Middleware {
+	allowAll := false
+	for _, origin := range opts.AllowOrigins {
+		if origin == "*" {
+			allowAll = true
+		}
+	}
+	if allowAll && opts.AllowCredentials {
+		panic("expresso: CORS AllowCredentials cannot be used with the \"*\" origin, list the allowed origins instead")
+	}
+
+	methods := opts.AllowMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete}
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(opts.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(opts.ExposeHeaders, ", ")
+	maxAge := strconv.Itoa(int(opts.MaxAge / time.Second))
+
+	return func(ctx *Context) {
+		headers := ctx.Response.Headers
+		origin := ctx.Request.Headers.Get("Origin")
+		preflight := ctx.Request.Method == http.MethodOptions && ctx.Request.Headers.Get("Access-Control-Request-Method") != ""
+
+		// The response depends on the Origin unless every origin gets the same "*".
+		if !allowAll {
+			headers.Add("Vary", "Origin")
+		}
+		if origin == "" || !(allowAll || originAllowed(opts, origin)) {
+			ctx.Next()
+			return
+		}
+
+		if allowAll {
+			headers.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			headers.Set("Access-Control-Allow-Origin", origin)
+		}
+		if opts.AllowCredentials {
+			headers.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				headers.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			ctx.Next()
+			return
+		}
+
+		headers.Add("Vary", "Access-Control-Request-Method")
+		headers.Add("Vary", "Access-Control-Request-Headers")
+		headers.Set("Access-Control-Allow-Methods", allowMethods)
+		if allowHeaders != "" {
+			headers.Set("Access-Control-Allow-Headers", allowHeaders)
+		} else if requested := ctx.Request.Headers.Get("Access-Control-Request-Headers"); requested != "" {
+			headers.Set("Access-Control-Allow-Headers", requested)
+		}
+		if opts.MaxAge > 0 {
+			headers.Set("Access-Control-Max-Age", maxAge)
+		}
+		ctx.SendStatus(http.StatusNoContent)
+	}
+}
+
+// originAllowed reports whether origin matches an entry of AllowOrigins or is accepted by AllowOriginFunc.
+func originAllowed(opts CorsOptions, origin string) bool {
+	lower := strings.ToLower(origin)
+	for _, allowed := range opts.AllowOrigins {
+		allowed = strings.ToLower(allowed)
+		if prefix, suffix, wildcard := strings.Cut(allowed, "*"); wildcard {
+			if len(lower) > len(prefix)+len(suffix) && strings.HasPrefix(lower, prefix) && strings.HasSuffix(lower, suffix) &&
+				!strings.ContainsAny(lower[len(prefix):len(lower)-len(suffix)], "/:") {
+				return true
+			}
+		} else if lower == allowed {
+			return true
+		}
+	}
+	return opts.AllowOriginFunc != nil && opts.AllowOriginFunc(origin)
+}
@@ -0,0 +1,177 @@
+package expresso
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCorsApp returns an App applying opts to every route, with GET /data replying 200.
+func newCorsApp(opts CorsOptions) *App {
+	app := newTestApp()
+	app.Use(NewCorsMiddleware(opts))
+	app.GET("/data", func(ctx *Context) {
+		ctx.Send(Text{Content: "data"})
+	})
+	return app
+}
+
+// corsRequest serves a request with an Origin header, and Access-Control-Request-Method if method is OPTIONS.
+func corsRequest(app *App, method, origin string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/data", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if method == http.MethodOptions {
+		req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+		req.Header.Set("Access-Control-Request-Headers", "X-Token")
+	}
+	return serve(app, req)
+}
+
+func TestCorsOrigins(t *testing.T) {
+	opts := CorsOptions{
+		AllowOrigins:    []string{"https://example.com", "https://*.example.org"},
+		AllowOriginFunc: func(origin string) bool { return origin == "https://partner.test" },
+	}
+	app := newCorsApp(opts)
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://example.com", true},
+		{"HTTPS://EXAMPLE.COM", true},
+		{"https://api.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://partner.test", true},
+		{"http://example.com", false},
+		{"https://example.com:8443", false},
+		{"https://example.org", false},
+		{"https://evilexample.org", false},
+		{"https://evil.test/.example.org", false},
+		{"https://evil.test:1.example.org", false},
+		{"https://evil.test", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		w := corsRequest(app, http.MethodGet, tt.origin)
+		if w.Code != http.StatusOK {
+			t.Errorf("origin %q: status = %d, want the handler to run", tt.origin, w.Code)
+		}
+		want := ""
+		if tt.allowed {
+			want = tt.origin
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != want {
+			t.Errorf("origin %q: Access-Control-Allow-Origin = %q, want %q", tt.origin, got, want)
+		}
+		if !headerContainsToken(w.Header(), "Vary", "Origin") {
+			t.Errorf("origin %q: Vary = %q, want Origin", tt.origin, w.Header().Values("Vary"))
+		}
+	}
+}
+
+func TestCorsSimpleRequest(t *testing.T) {
+	app := newCorsApp(CorsOptions{
+		AllowOrigins:  []string{"https://example.com"},
+		ExposeHeaders: []string{"X-Total", "X-Page"},
+		MaxAge:        time.Hour,
+	})
+	w := corsRequest(app, http.MethodGet, "https://example.com")
+
+	if w.Code != http.StatusOK || w.Body.String() != "data" {
+		t.Errorf("response = %d %q, want the handler's", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-Total, X-Page" {
+		t.Errorf("Access-Control-Expose-Headers = %q", got)
+	}
+	for _, name := range []string{"Access-Control-Allow-Methods", "Access-Control-Max-Age", "Access-Control-Allow-Credentials"} {
+		if got := w.Header().Get(name); got != "" {
+			t.Errorf("%s = %q, want it only on preflight responses", name, got)
+		}
+	}
+}
+
+func TestCorsPreflight(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    CorsOptions
+		methods string
+		headers string
+	}{
+		{
+			"defaults",
+			CorsOptions{AllowOrigins: []string{"https://example.com"}},
+			"GET, HEAD, PUT, PATCH, POST, DELETE", "X-Token",
+		},
+		{
+			"configured",
+			CorsOptions{AllowOrigins: []string{"https://example.com"}, AllowMethods: []string{"PUT"}, AllowHeaders: []string{"Content-Type"}, MaxAge: 10 * time.Minute},
+			"PUT", "Content-Type",
+		},
+	}
+	for _, tt := range tests {
+		w := corsRequest(newCorsApp(tt.opts), http.MethodOptions, "https://example.com")
+		if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+			t.Errorf("%s: response = %d %q, want an empty 204", tt.name, w.Code, w.Body.String())
+		}
+		header := w.Header()
+		if got := header.Get("Access-Control-Allow-Methods"); got != tt.methods {
+			t.Errorf("%s: Access-Control-Allow-Methods = %q, want %q", tt.name, got, tt.methods)
+		}
+		if got := header.Get("Access-Control-Allow-Headers"); got != tt.headers {
+			t.Errorf("%s: Access-Control-Allow-Headers = %q, want %q", tt.name, got, tt.headers)
+		}
+		if got, want := header.Get("Access-Control-Max-Age"), map[bool]string{true: "600"}[tt.opts.MaxAge > 0]; got != want {
+			t.Errorf("%s: Access-Control-Max-Age = %q, want %q", tt.name, got, want)
+		}
+		for _, vary := range []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"} {
+			if !headerContainsToken(header, "Vary", vary) {
+				t.Errorf("%s: Vary = %q, want %s", tt.name, header.Values("Vary"), vary)
+			}
+		}
+	}
+
+	// A preflight from a rejected origin gets no CORS headers, so the browser blocks the request.
+	w := corsRequest(newCorsApp(CorsOptions{AllowOrigins: []string{"https://example.com"}}), http.MethodOptions, "https://evil.test")
+	if w.Code == http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("rejected preflight: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCorsAnyOrigin(t *testing.T) {
+	app := newCorsApp(CorsOptions{AllowOrigins: []string{"*"}})
+	w := corsRequest(app, http.MethodGet, "https://anywhere.test")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if headerContainsToken(w.Header(), "Vary", "Origin") {
+		t.Error("Vary: Origin set although every origin gets the same response")
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want none", got)
+	}
+}
+
+func TestCorsCredentials(t *testing.T) {
+	app := newCorsApp(CorsOptions{AllowOrigins: []string{"https://example.com"}, AllowCredentials: true})
+	for _, method := range []string{http.MethodGet, http.MethodOptions} {
+		w := corsRequest(app, method, "https://example.com")
+		if w.Header().Get("Access-Control-Allow-Origin") != "https://example.com" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("%s: headers = %v, want the origin reflected with credentials", method, w.Header())
+		}
+	}
+	w := corsRequest(app, http.MethodGet, "https://evil.test")
+	if w.Header().Get("Access-Control-Allow-Credentials") != "" || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("rejected origin: headers = %v, want no CORS headers", w.Header())
+	}
+
+	defer func() {
+		if recovered := recover(); recovered == nil || !strings.Contains(recovered.(string), "AllowCredentials") {
+			t.Errorf("recovered %v, want a panic rejecting credentials for any origin", recovered)
+		}
+	}()
+	NewCorsMiddleware(CorsOptions{AllowOrigins: []string{"https://example.com", "*"}, AllowCredentials: true})
+}
@@ -0,0 +1,112 @@
+package expresso
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+// HTTPError is an error carrying the HTTP status code and the public message to send
+// to the client. The optional Cause is logged but never exposed in the response.
+type HTTPError struct {
+	Code    int    // The HTTP status code of the response.
+	Message string // The message sent to the client.
+	Cause   error  // The underlying error, if any.
+}
+
+// NewHTTPError creates an HTTPError with the given status code, public message and cause.
+// An empty message defaults to the standard status text for the code.
+func NewHTTPError(code int, message string, cause error) *HTTPError {
+	if message == "" {
+		message = http.StatusText(code)
+	}
+	return &HTTPError{Code: code, Message: message, Cause: cause}
+}
+
+// Error returns the status code and message, followed by the cause if present and not already
+// included at the end of the message, as for errors built from their cause's description.
+func (e *HTTPError) Error() string {
+	if e.Cause != nil && !strings.HasSuffix(e.Message, e.Cause.Error()) {
+		return fmt.Sprintf("%d %s: %s", e.Code, e.Message, e.Cause.Error())
+	}
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+// Unwrap returns the underlying cause so HTTPError works with errors.Is and errors.As.
+func (e *HTTPError) Unwrap() error {
+	return e.Cause
+}
+
+// Handler is a request handler that returns an error instead of writing error responses itself.
+// A non-nil error is passed to the App's error handler, see App.OnError.
+type Handler func(*Context) error
+
+// ErrorHandler turns an error returned by a Handler, or passed to Context.Fail, into a response.
+type ErrorHandler func(*Context, error)
+
+// Catch adapts a Handler into a Middleware. Errors returned by the handler are passed to Context.Fail.
+// As with any Middleware, the handler must call Next for the chain to continue.
+func Catch(handler Handler) Middleware {
+	return func(ctx *Context) {
+		if err := handler(ctx); err != nil {
+			ctx.Fail(err)
+		}
+	}
+}
+
+// DefaultErrorHandler logs the error and replies with a Formatted error response.
+// A ValidationError results in a 422 listing each failing field, an HTTPError sets the
+// status code and message, and any other error results in a 500 whose details are only
+// written to the log. Config.StrictNegotiation does not apply, so the error status is kept
+// even if the client accepts none of the formats.
+func DefaultErrorHandler(ctx *Context, err error) {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		ctx.Status(http.StatusUnprocessableEntity).formatted(ctx.RawRequest, validationFormatted(validationErr), false)
+		return
+	}
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		httpErr = NewHTTPError(http.StatusInternalServerError, "", err)
+	}
+
+	if httpErr.Cause != nil {
+		ctx.Error(httpErr.Error())
+	}
+
+	ctx.Status(httpErr.Code).formatted(ctx.RawRequest, errorFormatted(httpErr.Code, httpErr.Message), false)
+}
+
+// errorFormatted builds the standard error response body in every supported format.
+func errorFormatted(code int, message string) Formatted {
+	title := fmt.Sprintf("%d - %s", code, message)
+	escaped := html.EscapeString(title)
+	data := map[string]interface{}{
+		"status": code,
+		"error":  message,
+	}
+
+	return Formatted{
+		Text: &Text{title},
+		HTML: &HTML{"<html><head><title>" + escaped + "</title></head><body>" + escaped + "</body></html>"},
+		JSON: &JSON{Data: data},
+		XML: &XML{
+			Data: struct {
+				XMLName xml.Name `xml:"error"`
+				Status  int      `xml:"status"`
+				Error   string   `xml:"error"`
+			}{
+				Status: code,
+				Error:  message,
+			},
+		},
+		YAML:    &YAML{Data: data},
+		MsgPack: &MsgPack{Data: data},
+		CBOR:    &CBOR{Data: data},
+		Default: &JSON{Data: data},
+	}
+}
@@ -0,0 +1,162 @@
+package expresso
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPError(t *testing.T) {
+	cause := errors.New("connection refused")
+	tests := []struct {
+		err  *HTTPError
+		want string
+	}{
+		{NewHTTPError(404, "", nil), "404 Not Found"},
+		{NewHTTPError(400, "bad id", nil), "400 bad id"},
+		{NewHTTPError(503, "database unavailable", cause), "503 database unavailable: connection refused"},
+		{NewHTTPError(502, "upstream: connection refused", cause), "502 upstream: connection refused"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+
+	wrapped := fmt.Errorf("loading user: %w", NewHTTPError(503, "", cause))
+	var httpErr *HTTPError
+	if !errors.As(wrapped, &httpErr) || httpErr.Code != 503 || !errors.Is(wrapped, cause) {
+		t.Errorf("errors.As/Is on %v failed", wrapped)
+	}
+}
+
+func TestDefaultErrorHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		body   string
+	}{
+		{"HTTPError", NewHTTPError(404, "user not found", nil), 404, `{"error":"user not found","status":404}`},
+		{"wrapped HTTPError", fmt.Errorf("handler: %w", NewHTTPError(409, "", nil)), 409, `{"error":"Conflict","status":409}`},
+		// The details of other errors are only logged.
+		{"other error", errors.New("secret dsn"), 500, `{"error":"Internal Server Error","status":500}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp()
+			var logger *Logger
+			app.GET("/", Catch(func(ctx *Context) error {
+				logger = ctx.Logger
+				return tt.err
+			}))
+
+			w := serve(app, httptest.NewRequest("GET", "/", nil))
+			if w.Code != tt.status || w.Body.String() != tt.body {
+				t.Errorf("got %d %q, want %d %q", w.Code, w.Body, tt.status, tt.body)
+			}
+			if tt.status == 500 && (len(logger.logs) != 1 || !strings.Contains(logger.logs[0].Message, "secret dsn")) {
+				t.Errorf("logs = %v, want the error details", logger.logs)
+			}
+		})
+	}
+}
+
+func TestDefaultErrorHandlerFormats(t *testing.T) {
+	app := newTestApp()
+	app.GET("/", Catch(func(ctx *Context) error {
+		return NewHTTPError(403, "<forbidden>", nil)
+	}))
+
+	tests := []struct {
+		accept, body string
+	}{
+		{"text/plain", "403 - <forbidden>"},
+		{"text/html", "<html><head><title>403 - &lt;forbidden&gt;</title></head><body>403 - &lt;forbidden&gt;</body></html>"},
+		{"application/xml", "<error><status>403</status><error>&lt;forbidden&gt;</error></error>"},
+		// The error status is kept even if no format is acceptable.
+		{"image/png", `{"error":"\u003cforbidden\u003e","status":403}`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		w := serve(app, req)
+		if w.Code != 403 || w.Body.String() != tt.body {
+			t.Errorf("Accept %s: got %d %q, want 403 %q", tt.accept, w.Code, w.Body, tt.body)
+		}
+	}
+}
+
+func TestOnError(t *testing.T) {
+	app := newTestApp()
+	var handled error
+	app.OnError(func(ctx *Context, err error) {
+		handled = err
+		ctx.Status(http.StatusTeapot).Send(Text{Content: "custom: " + err.Error()})
+	})
+	app.Use(func(ctx *Context) {
+		if ctx.Request.Headers.Get("X-Fail") != "" {
+			ctx.Fail(errors.New("middleware"))
+			return
+		}
+		ctx.Next()
+	})
+	app.GET("/", Catch(func(ctx *Context) error {
+		return errors.New("handler")
+	}))
+
+	tests := []struct {
+		fail bool
+		want string
+	}{
+		{false, "custom: handler"},
+		{true, "custom: middleware"}, // Fail reaches the same handler.
+	}
+	for _, tt := range tests {
+		handled = nil
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.fail {
+			req.Header.Set("X-Fail", "1")
+		}
+		w := serve(app, req)
+		if w.Code != http.StatusTeapot || w.Body.String() != tt.want {
+			t.Errorf("got %d %q, want 418 %q", w.Code, w.Body, tt.want)
+		}
+		if handled == nil {
+			t.Error("the custom error handler was not called")
+		}
+	}
+}
+
+func TestFailAfterHeadersSent(t *testing.T) {
+	for _, custom := range []bool{false, true} {
+		app := newTestApp()
+		if custom {
+			app.OnError(func(ctx *Context, err error) {
+				ctx.Status(500).Send(Text{Content: "custom"})
+			})
+		}
+		var logger *Logger
+		app.GET("/", Catch(func(ctx *Context) error {
+			logger = ctx.Logger
+			ctx.Status(201).Send(Text{Content: "created"})
+			return errors.New("after the response")
+		}))
+
+		// The response already sent is kept; the error response is discarded with a warning.
+		w := serve(app, httptest.NewRequest("GET", "/", nil))
+		if w.Code != 201 || w.Body.String() != "created" {
+			t.Errorf("custom handler %v: got %d %q, want 201 %q", custom, w.Code, w.Body, "created")
+		}
+		var warned bool
+		for _, log := range logger.logs {
+			warned = warned || log.Level == LogLevelWarn && strings.Contains(log.Message, "already written")
+		}
+		if !warned {
+			t.Errorf("custom handler %v: logs = %v, want a warning about the discarded response", custom, logger.logs)
+		}
+	}
+}
@@ -35,5 +35,5 @@ func App() *expresso.App {
 		})
 	})
 
-	return &app
+	return app
 }
@@ -1,6 +1,6 @@
 module expresso_example
 
-go 1.19
+go 1.21
 
 require github.com/pr47h4m/expresso v1.0.0
 
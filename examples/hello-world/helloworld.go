@@ -13,5 +13,5 @@ func App() *expresso.App {
 		})
 	})
 
-	return &app
+	return app
 }
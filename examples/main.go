@@ -1,62 +1,57 @@
 package main
 
 import (
+	"context"
 	basicrouting "expresso_example/basic-routing"
 	helloworld "expresso_example/hello-world"
 	servestatic "expresso_example/serve-static"
+	"expresso_example/views"
 	webservice "expresso_example/web-service"
 	"fmt"
-	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+
+	"github.com/pr47h4m/expresso"
 )
 
 func main() {
 
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	done := make(chan bool, 1)
-
-	go helloworld.App().ListenAndServe(":81", nil)
-	// go helloworld.App().ListenAndServeTLS(":81", "server.crt", "server.key", func(err error) {
-	// 	if err != nil {
-	// 		fmt.Println("Unable to start helloworld server on port 81", err)
-	// 	} else {
-	// 		fmt.Println("helloworld server is running on port 81")
-	// 	}
-	// })
-	go basicrouting.App().ListenAndServe(":82", nil)
-	// go basicrouting.App().ListenAndServeTLS(":82", "server.crt", "server.key", func(err error) {
-	// 	if err != nil {
-	// 		fmt.Println("Unable to start basicrouting server on port 81", err)
-	// 	} else {
-	// 		fmt.Println("basicrouting server is running on port 81")
-	// 	}
-	// })
-	go servestatic.App().ListenAndServe(":83", func(err error) {
-		if err != nil {
-			fmt.Println("Unable to start servestatic server on port 81", err)
-		} else {
-			fmt.Println("servestatic server is running on port 81")
-		}
-	})
-	// go servestatic.App().ListenAndServeTLS(":83", "server.crt", "server.key", nil)
-	go webservice.App().ListenAndServe(":84", func(err error) {
-		if err != nil {
-			fmt.Println("Unable to start webservice server on port 81", err)
-		} else {
-			fmt.Println("webservice server is running on port 81")
-		}
-	})
-	// go webservice.App().ListenAndServeTLS(":84", "server.crt", "server.key", nil)
-
-	go func() {
-		fmt.Println("press Ctrl+C to exit.")
-		<-sig
-		fmt.Println("\nCtrl+C pressed. Exiting...")
-		done <- true
-		os.Exit(0)
-	}()
-
-	<-done
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	servers := []struct {
+		name string
+		addr string
+		app  *expresso.App
+	}{
+		{"helloworld", ":81", helloworld.App()},
+		{"basicrouting", ":82", basicrouting.App()},
+		{"servestatic", ":83", servestatic.App()},
+		{"webservice", ":84", webservice.App()},
+		{"views", ":85", views.App()},
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		s := s
+		s.app.OnShutdown(func() {
+			fmt.Println(s.name, "server stopped")
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fmt.Println(s.name, "server is running on port", s.addr)
+			if err := s.app.ListenAndServeContext(ctx, s.addr); err != nil {
+				fmt.Println("Unable to start", s.name, "server on port", s.addr, err)
+			}
+			// s.app.ListenAndServeTLSContext(ctx, s.addr, "server.crt", "server.key")
+		}()
+	}
+
+	fmt.Println("press Ctrl+C to exit.")
+	<-ctx.Done()
+	fmt.Println("\nCtrl+C pressed. Draining in-flight requests...")
+	wg.Wait()
 }
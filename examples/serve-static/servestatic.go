@@ -57,5 +57,5 @@ func App() *expresso.App {
 	fsys := dotFileHidingFileSystem{http.Dir("serve-static/private")}
 	app.ServeStatic("/private/*filepath", http.FileSystem(fsys))
 
-	return &app
+	return app
 }
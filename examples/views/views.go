@@ -0,0 +1,31 @@
+package views
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/pr47h4m/expresso"
+)
+
+func App() *expresso.App {
+	app := expresso.DefaultApp()
+	app.Development = true // Pick up edited templates without restarting.
+
+	app.Views("views/templates", ".html").Funcs(template.FuncMap{
+		"upper": strings.ToUpper,
+	})
+
+	app.GET("/", expresso.Catch(func(ctx *expresso.Context) error {
+		return ctx.Render("index", map[string]interface{}{
+			"Name": "world",
+		})
+	}))
+
+	app.GET("/users", expresso.Catch(func(ctx *expresso.Context) error {
+		return ctx.Render("users/index", map[string]interface{}{
+			"Users": []string{"pr47h4m", "gautam"},
+		})
+	}))
+
+	return app
+}
@@ -1,10 +1,9 @@
 package webservice
 
 import (
-	"encoding/json"
-	"encoding/xml"
 	"net/http"
-	"strings"
+	"os"
+	"path/filepath"
 
 	"github.com/pr47h4m/expresso"
 )
@@ -18,49 +17,47 @@ func GetUsers(ctx *expresso.Context) {
 	})
 }
 
-func CreateUser(ctx *expresso.Context) {
-
-	cType := strings.Split(ctx.Request.Headers.Get("Content-Type"), ";")[0]
-
+func CreateUser(ctx *expresso.Context) error {
 	user := User{}
-	ctx.Debug("body: " + string(ctx.Request.Body))
+	body, err := ctx.BodyBytes()
+	if err != nil {
+		return err
+	}
+	ctx.Debug("body: " + string(body))
 	ctx.Debug("query params: " + string(ctx.QueryParams.Encode()))
-	switch cType {
-	case "application/json":
-		if err := json.Unmarshal(ctx.Request.Body, &user); err != nil {
-			ctx.Error("error unmarshalling json: " + err.Error())
-			ctx.SendStatus(400)
-			return
-		}
-	case "application/xml":
-		if err := xml.Unmarshal(ctx.Request.Body, &user); err != nil {
-			ctx.Error("error unmarshalling xml: " + err.Error())
-			ctx.SendStatus(400)
-			return
-		}
-	case "application/x-www-form-urlencoded":
-		user.Name = ctx.RawRequest.Form.Get("name")
-	case "multipart/form-data":
-		if err := ctx.RawRequest.ParseMultipartForm(1 << 20); err != nil {
-			ctx.Error("error parsing multipart form: " + err.Error())
-			ctx.SendStatus(400)
-			return
-		}
-		user.Name = ctx.RawRequest.FormValue("name")
-	default:
-		ctx.Error("invalid content type: " + cType)
-		ctx.SendStatus(400)
-		return
+	if err := ctx.Bind(&user); err != nil {
+		return err
 	}
 
-	if user.Name != "" {
-		users = append(users, user)
-		userRepos[user] = []Repo{}
-		ctx.Status(http.StatusCreated).Send(expresso.JSON{
-			Data: map[string]interface{}{
-				"status": "201",
-				"user":   user,
-			},
-		})
+	users = append(users, user)
+	userRepos[user] = []Repo{}
+	ctx.Status(http.StatusCreated).Send(expresso.JSON{
+		Data: map[string]interface{}{
+			"status": "201",
+			"user":   user,
+		},
+	})
+	return nil
+}
+
+func UploadAvatar(ctx *expresso.Context) error {
+	name := ctx.Params.ByName("name")
+	avatar, err := ctx.FormFile("avatar")
+	if err != nil {
+		return err
+	}
+
+	dst := filepath.Join(os.TempDir(), "avatars", filepath.Base(name)+filepath.Ext(avatar.Filename))
+	if err := ctx.SaveUploadedFile(avatar, dst); err != nil {
+		return err
 	}
+	ctx.Status(http.StatusCreated).Send(expresso.JSON{
+		Data: map[string]interface{}{
+			"status": "201",
+			"avatar": filepath.Base(dst),
+			"type":   avatar.ContentType,
+			"size":   avatar.Size,
+		},
+	})
+	return nil
 }
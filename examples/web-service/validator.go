@@ -8,7 +8,7 @@ import (
 )
 
 func ValidateAPIKey(ctx *expresso.Context) {
-	key := ctx.Headers.Get("api-key")
+	key := ctx.Request.Headers.Get("api-key")
 	if key == "" {
 		ctx.Info("api-key not found in headers, checking query params")
 		key = ctx.QueryParams.Get("api-key")
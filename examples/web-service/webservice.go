@@ -14,7 +14,7 @@ type Repo struct {
 
 type User struct {
 	XMLName xml.Name `xml:"User"`
-	Name    string   `json:"name" xml:"Name"`
+	Name    string   `json:"name" xml:"Name" form:"name" validate:"required,max=39"`
 }
 
 var (
@@ -45,22 +45,30 @@ var (
 
 func App() *expresso.App {
 	app := expresso.DefaultApp()
+	app.Use(expresso.NewRequestIDMiddleware(expresso.RequestIDOptions{}))
 
-	app.GET("/api", ValidateAPIKey, func(ctx *expresso.Context) {
+	api := app.Group("/api", ValidateAPIKey)
+
+	api.GET("/", func(ctx *expresso.Context) {
 		ctx.Send(expresso.HTML{Content: "<html><head><title>Web Service in Go</title></head><body><h1>Web Service in Go</h1><h3>\npowered by github.com/pr47h4m/expresso</h3></body></html>"})
 	})
 
-	app.GET("/api/users", ValidateAPIKey, GetUsers)
+	api.GET("/users", GetUsers)
+
+	api.POST("/users", expresso.Catch(CreateUser))
 
-	app.POST("/api/users", ValidateAPIKey, CreateUser)
+	api.GET("/repos", GetRepos)
 
-	app.GET("/api/repos", ValidateAPIKey, GetRepos)
+	api.GET("/users/:name/repos", GetUserRepos)
 
-	app.GET("/api/users/:name/repos", ValidateAPIKey, GetUserRepos)
+	api.POST("/users/:name/avatar", expresso.UploadLimits(expresso.UploadOptions{
+		MaxFileSize:  1 << 20,
+		AllowedTypes: []string{"image/png", "image/jpeg"},
+	}), expresso.Catch(UploadAvatar))
 
 	app.HandleNotFound(HandleNotFound)
 
-	return &app
+	return app
 }
 
 func HandleNotFound(ctx *expresso.Context) {
@@ -1,6 +1,6 @@
 module github.com/pr47h4m/expresso
 
-go 1.19
+go 1.21
 
 require (
 	github.com/julienschmidt/httprouter v1.3.0
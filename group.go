@@ -0,0 +1,94 @@
+package expresso
+
+import "strings"
+
+// Group is a set of routes sharing a common path prefix and middleware.
+// Routes registered on a Group are added to the App it was created from,
+// with the group's middleware running before the route's own middleware.
+type Group struct {
+	app         *App         // The application the group's routes are registered on.
+	prefix      string       // The path prefix prepended to every route in the group.
+	middlewares []Middleware // Middleware run before each route's own middleware.
+}
+
+// Group creates a route group whose routes are prefixed with prefix and run the given middleware first.
+func (a *App) Group(prefix string, middlewares ...Middleware) *Group {
+	return &Group{
+		app:         a,
+		prefix:      cleanPrefix(prefix),
+		middlewares: middlewares,
+	}
+}
+
+// Group creates a nested group inheriting this group's prefix and middleware.
+func (g *Group) Group(prefix string, middlewares ...Middleware) *Group {
+	return &Group{
+		app:         g.app,
+		prefix:      g.prefix + cleanPrefix(prefix),
+		middlewares: g.chain(middlewares),
+	}
+}
+
+// HEAD registers a HEAD request handler for the specified path within the group.
+func (g *Group) HEAD(path string, middlewares ...Middleware) {
+	g.app.HEAD(g.path(path), g.chain(middlewares)...)
+}
+
+// OPTIONS registers an OPTIONS request handler for the specified path within the group.
+func (g *Group) OPTIONS(path string, middlewares ...Middleware) {
+	g.app.OPTIONS(g.path(path), g.chain(middlewares)...)
+}
+
+// GET registers a GET request handler for the specified path within the group.
+func (g *Group) GET(path string, middlewares ...Middleware) {
+	g.app.GET(g.path(path), g.chain(middlewares)...)
+}
+
+// POST registers a POST request handler for the specified path within the group.
+func (g *Group) POST(path string, middlewares ...Middleware) {
+	g.app.POST(g.path(path), g.chain(middlewares)...)
+}
+
+// PATCH registers a PATCH request handler for the specified path within the group.
+func (g *Group) PATCH(path string, middlewares ...Middleware) {
+	g.app.PATCH(g.path(path), g.chain(middlewares)...)
+}
+
+// PUT registers a PUT request handler for the specified path within the group.
+func (g *Group) PUT(path string, middlewares ...Middleware) {
+	g.app.PUT(g.path(path), g.chain(middlewares)...)
+}
+
+// DELETE registers a DELETE request handler for the specified path within the group.
+func (g *Group) DELETE(path string, middlewares ...Middleware) {
+	g.app.DELETE(g.path(path), g.chain(middlewares)...)
+}
+
+// path joins the group prefix with a route path, which gets a leading slash if it lacks one.
+// A path of "/" maps to the prefix itself.
+func (g *Group) path(path string) string {
+	if path == "" || path == "/" {
+		if g.prefix == "" {
+			return "/"
+		}
+		return g.prefix
+	}
+	return g.prefix + "/" + strings.TrimLeft(path, "/")
+}
+
+// cleanPrefix normalizes a group prefix to a single leading slash and no trailing slash,
+// e.g. "api/" and "//api" both become "/api". The root prefixes "" and "/" become "".
+func cleanPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// chain returns the group's middleware followed by the given route middleware.
+func (g *Group) chain(middlewares []Middleware) []Middleware {
+	chain := make([]Middleware, 0, len(g.middlewares)+len(middlewares))
+	chain = append(chain, g.middlewares...)
+	return append(chain, middlewares...)
+}
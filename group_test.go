@@ -0,0 +1,60 @@
+package expresso
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGroupPaths(t *testing.T) {
+	tests := []struct {
+		prefix, nested, route, request string
+	}{
+		{"/api", "", "/users", "/api/users"},
+		{"api", "", "users", "/api/users"},
+		{"/api/", "", "/users", "/api/users"},
+		{"//api//", "", "//users", "/api/users"},
+		{"/api", "", "/", "/api"},
+		{"/", "", "users", "/users"},
+		{"", "", "", "/"},
+		{"api", "v1/", "users/:id", "/api/v1/users/42"},
+		{"/api/", "/v1", "/", "/api/v1"},
+	}
+	for _, tt := range tests {
+		app := newTestApp()
+		g := app.Group(tt.prefix)
+		if tt.nested != "" {
+			g = g.Group(tt.nested)
+		}
+		g.GET(tt.route, func(ctx *Context) {
+			ctx.Send(Text{Content: "ok"})
+		})
+
+		w := serve(app, httptest.NewRequest("GET", tt.request, nil))
+		if w.Code != 200 || w.Body.String() != "ok" {
+			t.Errorf("Group(%q).Group(%q).GET(%q): GET %s = %d %q", tt.prefix, tt.nested, tt.route, tt.request, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestGroupMiddlewareOrder(t *testing.T) {
+	app := newTestApp()
+	var order []string
+	mark := func(name string) Middleware {
+		return func(ctx *Context) {
+			order = append(order, name)
+			ctx.Next()
+		}
+	}
+	api := app.Group("/api", mark("api"))
+	api.Group("/v1", mark("v1")).GET("/ping", mark("route"), func(ctx *Context) {
+		ctx.SendStatus(204)
+	})
+
+	w := serve(app, httptest.NewRequest("GET", "/api/v1/ping", nil))
+	if w.Code != 204 {
+		t.Fatalf("status = %d, want 204", w.Code)
+	}
+	if got := len(order); got != 3 || order[0] != "api" || order[1] != "v1" || order[2] != "route" {
+		t.Errorf("middleware order = %v, want [api v1 route]", order)
+	}
+}
@@ -0,0 +1,22 @@
+package expresso
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+)
+
+// newTestApp returns an App with default settings whose request logs are discarded.
+func newTestApp() *App {
+	app := DefaultApp()
+	app.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return app
+}
+
+// serve runs req through app and returns the recorded response.
+func serve(app *App, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	return w
+}
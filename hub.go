@@ -0,0 +1,301 @@
+package expresso
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultHubQueueSize is the default number of messages queued per connection before it is evicted.
+const DefaultHubQueueSize = 256
+
+// ErrSlowConsumer is returned when a message cannot be queued because the client is not reading
+// fast enough. The client is evicted from the hub and its connection closed.
+var ErrSlowConsumer = errors.New("expresso: websocket client evicted, send queue full")
+
+// Hub tracks WebSocket connections and the named rooms they have joined, and broadcasts messages to them.
+// Each client has a bounded send queue drained by its own goroutine, so a slow client never blocks
+// a broadcast; a client whose queue is full is evicted instead.
+//
+// Register the hub's Serve method as the handler of a WebSocket route:
+//
+//	hub := expresso.NewHub()
+//	hub.OnMessage = func(c *expresso.Client, messageType int, data []byte) {
+//		hub.BroadcastTo("lobby", messageType, data)
+//	}
+//	app.WS("/chat", hub.Serve, ValidateAPIKey)
+type Hub struct {
+	QueueSize    int           // Capacity of each client's send queue, DefaultHubQueueSize if zero.
+	PingInterval time.Duration // Interval between pings; clients not answering within two intervals are dropped. Zero disables pings.
+
+	OnConnect    func(*Client)                                 // Called when a client connects, before its messages are read.
+	OnDisconnect func(*Client)                                 // Called after a client disconnects or is evicted.
+	OnMessage    func(c *Client, messageType int, data []byte) // Called with each message received from a client.
+
+	mu      sync.RWMutex
+	clients map[*Client]struct{}
+	rooms   map[string]map[*Client]struct{}
+}
+
+// Client is a WebSocket connection registered with a Hub. The embedded WebSocket's Context
+// holds the upgrade request, including Extras set by middleware such as authentication.
+type Client struct {
+	*WebSocket
+
+	hub   *Hub
+	send  chan hubMessage
+	done  chan struct{}
+	rooms map[string]struct{} // Guarded by hub.mu.
+	once  sync.Once
+}
+
+// hubMessage is a message waiting in a client's send queue.
+type hubMessage struct {
+	messageType int
+	data        []byte
+}
+
+// NewHub creates an empty Hub.
+func NewHub() *Hub {
+	return &Hub{
+		clients: map[*Client]struct{}{},
+		rooms:   map[string]map[*Client]struct{}{},
+	}
+}
+
+// Serve registers the connection with the hub and reads its messages until it is closed.
+// It is a WebSocketHandler, to be passed to App.WS.
+func (h *Hub) Serve(ws *WebSocket) {
+	queueSize := h.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultHubQueueSize
+	}
+
+	c := &Client{
+		WebSocket: ws,
+		hub:       h,
+		send:      make(chan hubMessage, queueSize),
+		done:      make(chan struct{}),
+		rooms:     map[string]struct{}{},
+	}
+
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+	defer h.remove(c)
+
+	if h.PingInterval > 0 {
+		_ = ws.SetReadDeadline(time.Now().Add(2 * h.PingInterval))
+		ws.SetPongHandler(func([]byte) {
+			_ = ws.SetReadDeadline(time.Now().Add(2 * h.PingInterval))
+		})
+	}
+
+	go c.writeLoop()
+
+	if h.OnConnect != nil {
+		h.OnConnect(c)
+	}
+
+	for {
+		messageType, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if h.OnMessage != nil {
+			h.OnMessage(c, messageType, data)
+		}
+	}
+}
+
+// Broadcast queues a message for every connected client.
+func (h *Hub) Broadcast(messageType int, data []byte) {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.RUnlock()
+
+	for _, c := range clients {
+		_ = c.Send(messageType, data)
+	}
+}
+
+// BroadcastTo queues a message for every client in room.
+func (h *Hub) BroadcastTo(room string, messageType int, data []byte) {
+	for _, c := range h.Clients(room) {
+		_ = c.Send(messageType, data)
+	}
+}
+
+// BroadcastJSON queues v encoded as JSON in a text message for every client in room,
+// or for every connected client if room is empty.
+func (h *Hub) BroadcastJSON(room string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if room == "" {
+		h.Broadcast(TextMessage, data)
+	} else {
+		h.BroadcastTo(room, TextMessage, data)
+	}
+	return nil
+}
+
+// Clients returns the clients in room.
+func (h *Hub) Clients(room string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	clients := make([]*Client, 0, len(h.rooms[room]))
+	for c := range h.rooms[room] {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// Rooms returns the names of the rooms with at least one client.
+func (h *Hub) Rooms() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	rooms := make([]string, 0, len(h.rooms))
+	for room := range h.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Len returns the number of connected clients.
+func (h *Hub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// remove unregisters a disconnected client from the hub and all its rooms.
+func (h *Hub) remove(c *Client) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	for room := range c.rooms {
+		h.leave(c, room)
+	}
+	h.mu.Unlock()
+
+	c.stop()
+	if h.OnDisconnect != nil {
+		h.OnDisconnect(c)
+	}
+}
+
+// leave removes c from room, deleting the room once empty. The caller must hold h.mu.
+func (h *Hub) leave(c *Client, room string) {
+	delete(c.rooms, room)
+	if members, ok := h.rooms[room]; ok {
+		delete(members, c)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// Join adds the client to room.
+func (c *Client) Join(room string) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	if _, ok := c.hub.clients[c]; !ok {
+		return // Already disconnected.
+	}
+	if c.hub.rooms[room] == nil {
+		c.hub.rooms[room] = map[*Client]struct{}{}
+	}
+	c.hub.rooms[room][c] = struct{}{}
+	c.rooms[room] = struct{}{}
+}
+
+// Leave removes the client from room.
+func (c *Client) Leave(room string) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	c.hub.leave(c, room)
+}
+
+// Rooms returns the names of the rooms the client has joined.
+func (c *Client) Rooms() []string {
+	c.hub.mu.RLock()
+	defer c.hub.mu.RUnlock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Send queues a message for the client without blocking. If the queue is full the client is
+// evicted and ErrSlowConsumer returned.
+func (c *Client) Send(messageType int, data []byte) error {
+	select {
+	case <-c.done:
+		return ErrCloseSent
+	default:
+	}
+
+	select {
+	case c.send <- hubMessage{messageType, data}:
+		return nil
+	default:
+		c.evict()
+		return ErrSlowConsumer
+	}
+}
+
+// SendJSON queues v encoded as JSON in a text message, see Send.
+func (c *Client) SendJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Send(TextMessage, data)
+}
+
+// writeLoop drains the send queue and sends pings until the client disconnects.
+func (c *Client) writeLoop() {
+	var ping <-chan time.Time
+	if c.hub.PingInterval > 0 {
+		ticker := time.NewTicker(c.hub.PingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	for {
+		var err error
+		select {
+		case <-c.done:
+			return
+		case m := <-c.send:
+			err = c.WriteMessage(m.messageType, m.data)
+		case <-ping:
+			err = c.Ping(nil)
+		}
+		if err != nil {
+			c.stop()
+			c.conn.Close() // Unblocks the reader, which unregisters the client.
+			return
+		}
+	}
+}
+
+// evict closes the connection of a client that is not keeping up with its queue. The close runs in
+// the background with a short write deadline, which also unblocks a writer stuck on the network.
+func (c *Client) evict() {
+	c.stop()
+	go c.closeWithin(ClosePolicyViolation, "slow consumer", websocketCloseTimeout)
+}
+
+// stop signals the client's writer to exit and rejects further messages.
+func (c *Client) stop() {
+	c.once.Do(func() {
+		close(c.done)
+	})
+}
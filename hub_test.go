@@ -0,0 +1,113 @@
+package expresso
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newHubServer serves hub at /ws, returning the server URL.
+func newHubServer(t *testing.T, hub *Hub) string {
+	app := newTestApp()
+	app.WS("/ws", hub.Serve)
+	return startTestServer(t, app)
+}
+
+func TestHubRoomsAndBroadcast(t *testing.T) {
+	hub := NewHub()
+	connected := make(chan *Client, 2)
+	hub.OnConnect = func(c *Client) {
+		if c.Context.Request.Headers.Get("X-Room") != "" {
+			c.Join(c.Context.Request.Headers.Get("X-Room"))
+		}
+		connected <- c
+	}
+	url := newHubServer(t, hub)
+
+	a := dialWS(t, url, "/ws", http.Header{"X-Room": {"lobby"}})
+	<-connected
+	b := dialWS(t, url, "/ws", nil)
+	<-connected
+
+	hub.BroadcastTo("lobby", TextMessage, []byte("to lobby"))
+	hub.Broadcast(TextMessage, []byte("to all"))
+
+	if _, _, payload := a.readFrame(); string(payload) != "to lobby" {
+		t.Fatalf("a got %q, want the room message first", payload)
+	}
+	if _, _, payload := a.readFrame(); string(payload) != "to all" {
+		t.Fatalf("a got %q", payload)
+	}
+	if _, _, payload := b.readFrame(); string(payload) != "to all" {
+		t.Fatalf("b got %q, want only the broadcast", payload)
+	}
+}
+
+func TestHubEvictsClientThatNeverReads(t *testing.T) {
+	hub := NewHub()
+	hub.QueueSize = 2
+	connected := make(chan *Client, 1)
+	disconnected := make(chan struct{})
+	hub.OnConnect = func(c *Client) { connected <- c }
+	hub.OnDisconnect = func(*Client) { close(disconnected) }
+	url := newHubServer(t, hub)
+
+	dialWS(t, url, "/ws", nil) // Never reads.
+	client := <-connected
+
+	// Large messages fill the socket buffers, stalling the client's writer, then its queue.
+	message := []byte(strings.Repeat("x", 1<<20))
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = client.Send(BinaryMessage, message)
+		time.Sleep(time.Millisecond)
+	}
+	if !errors.Is(err, ErrSlowConsumer) {
+		t.Fatalf("Send() = %v, want ErrSlowConsumer", err)
+	}
+	if err := client.Send(BinaryMessage, message); !errors.Is(err, ErrCloseSent) {
+		t.Errorf("Send() after eviction = %v, want ErrCloseSent", err)
+	}
+
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("evicted client was never disconnected")
+	}
+	if n := hub.Len(); n != 0 {
+		t.Errorf("hub still has %d clients", n)
+	}
+}
+
+func TestHubJoinLeave(t *testing.T) {
+	hub := NewHub()
+	var mu sync.Mutex
+	var clients []*Client
+	connected := make(chan struct{}, 1)
+	hub.OnConnect = func(c *Client) {
+		mu.Lock()
+		clients = append(clients, c)
+		mu.Unlock()
+		connected <- struct{}{}
+	}
+	url := newHubServer(t, hub)
+	dialWS(t, url, "/ws", nil)
+	<-connected
+
+	c := clients[0]
+	c.Join("a")
+	c.Join("b")
+	rooms := c.Rooms()
+	sort.Strings(rooms)
+	if len(rooms) != 2 || rooms[0] != "a" || rooms[1] != "b" {
+		t.Fatalf("Rooms() = %v", rooms)
+	}
+	c.Leave("a")
+	if rooms := c.Rooms(); len(rooms) != 1 || rooms[0] != "b" {
+		t.Fatalf("Rooms() after Leave = %v", rooms)
+	}
+}
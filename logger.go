@@ -1,59 +1,131 @@
 package expresso
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Log levels constants used to indicate the severity of log messages.
 const (
+	LogLevelDebug = "DEBUG"
 	LogLevelInfo  = "INFO"
+	LogLevelWarn  = "WARN"
 	LogLevelError = "ERROR"
-	LogLevelDebug = "DEBUG"
 )
 
 // Log represents a single log entry with a severity level and a message.
 type Log struct {
-	Level   string // The severity level of the log (e.g., INFO, ERROR, DEBUG).
-	Message string // The content of the log message.
+	Level   string      // The severity level of the log (e.g., INFO, ERROR, DEBUG).
+	Message string      // The content of the log message.
+	Time    time.Time   // When the entry was logged.
+	Attrs   []slog.Attr // Key/value fields passed with the message.
 }
 
 // Logger captures and manages log entries associated with an HTTP request.
+// Entries are buffered and written once the request completes, so that they can carry the
+// response status and latency: to the App's slog.Logger if one is set with App.SetLogger,
+// or to the console otherwise.
 type Logger struct {
 	Path       *url.URL // The URL path of the request.
 	Method     string   // The HTTP method used for the request (e.g., GET, POST).
 	logs       []Log    // A slice of Log entries recorded during the request.
 	StatusCode int      // The HTTP status code that will be returned with the response.
+
+	start    time.Time       // When the request was received, used for the latency attribute.
+	ctx      context.Context // The request context, passed on to the slog handler.
+	sink     *slog.Logger    // Destination of the entries, nil for the console.
+	minLevel slog.Level      // Entries below this level are discarded.
+	attrs    []slog.Attr     // Request attributes attached to every entry, see With.
 }
 
 // NewLogger creates and returns a new Logger instance, initializing it with the request's path and method.
 func NewLogger(req *Request) *Logger {
+	ctx := context.Background()
+	if req.RawRequest != nil {
+		ctx = req.RawRequest.Context()
+	}
 	return &Logger{
 		Path:       req.Path,
 		Method:     req.Method,
 		StatusCode: 200, // Default status code is set to 200 (OK).
+		start:      time.Now(),
+		ctx:        ctx,
+		minLevel:   slog.LevelDebug,
 	}
 }
 
-// Info adds an informational log entry to the Logger.
-func (l *Logger) Info(message string) {
-	l.addLog(LogLevelInfo, message)
+// SetLogger sends request log entries to logger instead of the console. Each entry carries the
+// request's method, path, status and latency along with the fields passed to Context.Info and friends.
+// Entries are also filtered by Config.LogLevel before reaching the logger's handler.
+func (a *App) SetLogger(logger *slog.Logger) {
+	a.logger = logger
+}
+
+// With attaches key/value fields to every entry of the request, e.g. ctx.With("user", id).
+// Arguments are interpreted as in slog.Logger.Info.
+func (l *Logger) With(args ...interface{}) *Logger {
+	l.attrs = append(l.attrs, argsToAttrs(args)...)
+	return l
+}
+
+// Info adds an informational log entry to the Logger, with optional key/value fields, e.g. ctx.Info("created", "id", 42).
+func (l *Logger) Info(message string, args ...interface{}) {
+	l.addLog(LogLevelInfo, message, args)
 }
 
-// Error adds an error log entry to the Logger.
-func (l *Logger) Error(message string) {
-	l.addLog(LogLevelError, message)
+// Warn adds a warning log entry to the Logger, with optional key/value fields.
+func (l *Logger) Warn(message string, args ...interface{}) {
+	l.addLog(LogLevelWarn, message, args)
 }
 
-// Debug adds a debug log entry to the Logger.
-func (l *Logger) Debug(message string) {
-	l.addLog(LogLevelDebug, message)
+// Error adds an error log entry to the Logger, with optional key/value fields.
+func (l *Logger) Error(message string, args ...interface{}) {
+	l.addLog(LogLevelError, message, args)
 }
 
-// addLog is a helper function to append a log entry to the logs slice.
-func (l *Logger) addLog(level, message string) {
-	l.logs = append(l.logs, Log{Level: level, Message: message})
+// Debug adds a debug log entry to the Logger, with optional key/value fields.
+func (l *Logger) Debug(message string, args ...interface{}) {
+	l.addLog(LogLevelDebug, message, args)
+}
+
+// addLog is a helper function to append a log entry to the logs slice, skipping entries below the minimum level.
+func (l *Logger) addLog(level, message string, args []interface{}) {
+	if slogLevel(level) < l.minLevel {
+		return
+	}
+	l.logs = append(l.logs, Log{Level: level, Message: message, Time: time.Now(), Attrs: argsToAttrs(args)})
+}
+
+// requestAttrs returns the attributes describing the request, attached to every entry sent to the slog.Logger.
+func (l *Logger) requestAttrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("method", l.Method),
+		slog.String("path", l.Path.Path),
+		slog.Int("status", l.StatusCode),
+		slog.Duration("latency", time.Since(l.start)),
+	}
+	return append(attrs, l.attrs...)
+}
+
+// emit writes the entries to the slog.Logger set with App.SetLogger.
+func (l *Logger) emit() {
+	handler := l.sink.Handler()
+	requestAttrs := l.requestAttrs()
+	for _, log := range l.logs {
+		level := slogLevel(log.Level)
+		if !handler.Enabled(l.ctx, level) {
+			continue
+		}
+		record := slog.NewRecord(log.Time, level, log.Message, 0)
+		record.AddAttrs(requestAttrs...)
+		record.AddAttrs(log.Attrs...)
+		_ = handler.Handle(l.ctx, record)
+	}
 }
 
 // Dump prints all the logged messages to the console, formatted with colors
@@ -63,16 +135,20 @@ func (l *Logger) Dump() {
 	if len(l.logs) == 0 {
 		return // Exit if there are no logs to print.
 	}
+	if l.sink != nil {
+		l.emit()
+		return
+	}
 
 	logStr := "+---\n" // Start log dump with a separator line.
 
-	// Append the request method, path, and status code.
-	logStr += fmt.Sprintf("%s %s %s\n", l.colorizeMethod(), l.Path, l.colorizeStatusCode())
+	// Append the request method, path, status code and latency, followed by any request fields.
+	logStr += fmt.Sprintf("%s %s %s %s%s\n", l.colorizeMethod(), l.Path, l.colorizeStatusCode(), time.Since(l.start).Round(time.Microsecond), formatAttrs(l.attrs))
 
 	// Append each log entry with color based on its level.
 	for _, log := range l.logs {
 		log.Message = strings.ReplaceAll(strings.Trim(log.Message, "\n"), "\n", "\n| ")
-		logStr += fmt.Sprintf("%s %s\n", l.colorizeLevel(log.Level), log.Message)
+		logStr += fmt.Sprintf("%s %s%s\n", l.colorizeLevel(log.Level), log.Message, formatAttrs(log.Attrs))
 	}
 
 	logStr += "+---" // End log dump with a separator line.
@@ -116,8 +192,61 @@ func (l *Logger) colorizeStatusCode() string {
 func (l *Logger) colorizeLevel(level string) string {
 	colorMap := map[string]string{
 		LogLevelInfo:  "\033[0;32m| INFO\033[0m",
+		LogLevelWarn:  "\033[0;33m| WARN\033[0m",
 		LogLevelError: "\033[0;31m| ERROR\033[0m",
 		LogLevelDebug: "\033[0;34m| DEBUG\033[0m",
 	}
 	return colorMap[level]
 }
+
+// slogLevel converts a log level constant to its slog.Level. Unknown and empty levels map to slog.LevelDebug.
+func slogLevel(level string) slog.Level {
+	switch strings.ToUpper(level) {
+	case LogLevelInfo:
+		return slog.LevelInfo
+	case LogLevelWarn:
+		return slog.LevelWarn
+	case LogLevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// argsToAttrs converts alternating keys and values, or slog.Attr values, to attributes as slog.Logger does.
+func argsToAttrs(args []interface{}) []slog.Attr {
+	if len(args) == 0 {
+		return nil
+	}
+	var record slog.Record
+	record.Add(args...)
+	attrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+	return attrs
+}
+
+// formatAttrs formats attributes as space-prefixed key=value pairs for the console, quoting values where needed.
+func formatAttrs(attrs []slog.Attr) string {
+	var b strings.Builder
+	writeAttrs(&b, "", attrs)
+	return b.String()
+}
+
+// writeAttrs writes attributes to b, flattening groups into dotted keys.
+func writeAttrs(b *strings.Builder, prefix string, attrs []slog.Attr) {
+	for _, attr := range attrs {
+		value := attr.Value.Resolve()
+		if value.Kind() == slog.KindGroup {
+			writeAttrs(b, prefix+attr.Key+".", value.Group())
+			continue
+		}
+		text := value.String()
+		if text == "" || strings.ContainsAny(text, " =\"\n\t") {
+			text = strconv.Quote(text)
+		}
+		fmt.Fprintf(b, " %s%s=%s", prefix, attr.Key, text)
+	}
+}
@@ -0,0 +1,110 @@
+package expresso
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// logEntries serves a request to a handler logging at every level through an App whose entries are
+// written as JSON to a buffer, and returns the decoded entries.
+func logEntries(t *testing.T, logLevel string, handlerLevel slog.Level) []map[string]interface{} {
+	t.Helper()
+	var out bytes.Buffer
+	app := DefaultApp()
+	app.LogLevel = logLevel
+	app.SetLogger(slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: handlerLevel})))
+	app.GET("/users/:id", func(ctx *Context) {
+		ctx.With("user", "ana")
+		ctx.Debug("debug")
+		ctx.Info("info", "id", 42)
+		ctx.Warn("warn", slog.Group("db", slog.Int("rows", 3)))
+		ctx.Error("error")
+		ctx.Status(201).Send(Text{Content: "created"})
+	})
+	serve(app, httptest.NewRequest("GET", "/users/42?q=1", nil))
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("decoding %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLoggerLevels(t *testing.T) {
+	tests := []struct {
+		logLevel     string
+		handlerLevel slog.Level
+		want         []string
+	}{
+		{"", slog.LevelDebug, []string{"debug", "info", "warn", "error"}},
+		{LogLevelInfo, slog.LevelDebug, []string{"info", "warn", "error"}},
+		{LogLevelWarn, slog.LevelDebug, []string{"warn", "error"}},
+		{"error", slog.LevelDebug, []string{"error"}}, // Levels are case-insensitive.
+		// Entries must also pass the handler's own level.
+		{"", slog.LevelWarn, []string{"warn", "error"}},
+		{LogLevelInfo, slog.LevelError, []string{"error"}},
+	}
+	for _, tt := range tests {
+		var messages []string
+		for _, entry := range logEntries(t, tt.logLevel, tt.handlerLevel) {
+			messages = append(messages, entry["msg"].(string))
+		}
+		if !reflect.DeepEqual(messages, tt.want) {
+			t.Errorf("LogLevel %q, handler level %v: messages = %q, want %q", tt.logLevel, tt.handlerLevel, messages, tt.want)
+		}
+	}
+}
+
+func TestLoggerAttributes(t *testing.T) {
+	entries := logEntries(t, "", slog.LevelDebug)
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(entries))
+	}
+
+	levels := []string{"DEBUG", "INFO", "WARN", "ERROR"}
+	for i, entry := range entries {
+		if entry["level"] != levels[i] {
+			t.Errorf("entry %d: level = %v, want %s", i, entry["level"], levels[i])
+		}
+		// Every entry carries the request attributes, including those added with With.
+		want := map[string]interface{}{"method": "GET", "path": "/users/42", "status": 201.0, "user": "ana"}
+		for key, value := range want {
+			if entry[key] != value {
+				t.Errorf("entry %d: %s = %v, want %v", i, key, entry[key], value)
+			}
+		}
+		if _, ok := entry["latency"].(float64); !ok {
+			t.Errorf("entry %d: latency = %v, want a duration", i, entry["latency"])
+		}
+		if _, ok := entry["time"].(string); !ok {
+			t.Errorf("entry %d: time = %v, want a timestamp", i, entry["time"])
+		}
+	}
+
+	// Fields passed with the message are added after the request attributes.
+	if entries[1]["id"] != 42.0 {
+		t.Errorf("info entry: id = %v, want 42", entries[1]["id"])
+	}
+	if db, ok := entries[2]["db"].(map[string]interface{}); !ok || db["rows"] != 3.0 {
+		t.Errorf("warn entry: db = %v, want a group with rows 3", entries[2]["db"])
+	}
+}
+
+func TestFormatAttrs(t *testing.T) {
+	attrs := argsToAttrs([]interface{}{"id", 42, "name", "ana lee", "empty", "", slog.Group("db", slog.Int("rows", 3))})
+	if got, want := formatAttrs(attrs), ` id=42 name="ana lee" empty="" db.rows=3`; got != want {
+		t.Errorf("formatAttrs() = %q, want %q", got, want)
+	}
+}
@@ -5,3 +5,16 @@ package expresso
 // or other aspects of the context as needed. Middlewares can be chained together to handle requests
 // in a modular and reusable way.
 type Middleware func(*Context)
+
+// MiddlewareMode controls how Context.Next advances the middleware chain.
+type MiddlewareMode int
+
+const (
+	// MiddlewareModeSequential runs the next middleware after the current one returns.
+	// Calling Next only marks that the chain should continue. This is the default mode.
+	MiddlewareModeSequential MiddlewareMode = iota
+
+	// MiddlewareModeOnion runs the rest of the chain synchronously inside Next, so a
+	// middleware can run code after the downstream handlers have finished.
+	MiddlewareModeOnion
+)
@@ -0,0 +1,141 @@
+package expresso
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// recordOrder returns a middleware recording name before and after it calls Next.
+func recordOrder(order *[]string, name string) Middleware {
+	return func(ctx *Context) {
+		*order = append(*order, name+" before")
+		ctx.Next()
+		*order = append(*order, name+" after")
+	}
+}
+
+func TestMiddlewareModes(t *testing.T) {
+	tests := []struct {
+		mode MiddlewareMode
+		want []string
+	}{
+		// Next only marks that the chain continues once the middleware returns.
+		{MiddlewareModeSequential, []string{"app before", "app after", "route before", "route after", "handler"}},
+		// Next runs the rest of the chain, so code after it unwinds in reverse order.
+		{MiddlewareModeOnion, []string{"app before", "route before", "handler", "route after", "app after"}},
+	}
+	for _, tt := range tests {
+		var order []string
+		app := newTestApp()
+		app.MiddlewareMode = tt.mode
+		app.Use(recordOrder(&order, "app"))
+		app.GET("/", recordOrder(&order, "route"), func(ctx *Context) {
+			order = append(order, "handler")
+			ctx.SendStatus(204)
+		})
+
+		w := serve(app, httptest.NewRequest("GET", "/", nil))
+		if w.Code != 204 {
+			t.Errorf("mode %d: status = %d, want 204", tt.mode, w.Code)
+		}
+		if !reflect.DeepEqual(order, tt.want) {
+			t.Errorf("mode %d: order = %q, want %q", tt.mode, order, tt.want)
+		}
+	}
+}
+
+func TestMiddlewareHalts(t *testing.T) {
+	tests := []struct {
+		name string
+		mw   Middleware
+	}{
+		{"no Next", func(ctx *Context) {
+			ctx.SendStatus(401)
+		}},
+		{"Abort", func(ctx *Context) {
+			ctx.Abort()
+			ctx.SendStatus(401)
+		}},
+		{"Fail", func(ctx *Context) {
+			ctx.Fail(NewHTTPError(401, "unauthorized", nil))
+		}},
+	}
+	for _, mode := range []MiddlewareMode{MiddlewareModeSequential, MiddlewareModeOnion} {
+		for _, tt := range tests {
+			var order []string
+			app := newTestApp()
+			app.MiddlewareMode = mode
+			app.Use(recordOrder(&order, "outer"), func(ctx *Context) {
+				order = append(order, "guard")
+				tt.mw(ctx)
+			})
+			app.GET("/", recordOrder(&order, "route"), func(ctx *Context) {
+				order = append(order, "handler")
+				ctx.SendStatus(204)
+			})
+
+			w := serve(app, httptest.NewRequest("GET", "/", nil))
+			if w.Code != 401 {
+				t.Errorf("mode %d, %s: status = %d, want 401", mode, tt.name, w.Code)
+			}
+			want := []string{"outer before", "outer after", "guard"}
+			if mode == MiddlewareModeOnion {
+				want = []string{"outer before", "guard", "outer after"}
+			}
+			if !reflect.DeepEqual(order, want) {
+				t.Errorf("mode %d, %s: order = %q, want %q", mode, tt.name, order, want)
+			}
+		}
+	}
+}
+
+func TestMiddlewareAbortAfterNext(t *testing.T) {
+	tests := []struct {
+		mode MiddlewareMode
+		want []string
+	}{
+		// Abort after Next cancels the rest of the chain, which has not run yet.
+		{MiddlewareModeSequential, []string{"aborting"}},
+		// The rest of the chain already ran inside Next, so Abort has no effect.
+		{MiddlewareModeOnion, []string{"aborting", "handler"}},
+	}
+	for _, tt := range tests {
+		var order []string
+		app := newTestApp()
+		app.MiddlewareMode = tt.mode
+		app.Use(func(ctx *Context) {
+			order = append(order, "aborting")
+			ctx.Next()
+			ctx.Abort()
+		})
+		app.GET("/", func(ctx *Context) {
+			order = append(order, "handler")
+			ctx.SendStatus(204)
+		})
+
+		serve(app, httptest.NewRequest("GET", "/", nil))
+		if !reflect.DeepEqual(order, tt.want) {
+			t.Errorf("mode %d: order = %q, want %q", tt.mode, order, tt.want)
+		}
+	}
+}
+
+func TestMiddlewareNextRunsChainOnce(t *testing.T) {
+	var calls int
+	app := newTestApp()
+	app.MiddlewareMode = MiddlewareModeOnion
+	app.Use(func(ctx *Context) {
+		ctx.Next()
+		ctx.Next()
+	})
+	app.GET("/", func(ctx *Context) {
+		calls++
+		ctx.SendStatus(204)
+	})
+
+	serve(app, httptest.NewRequest("GET", "/", nil))
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
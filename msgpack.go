@@ -0,0 +1,391 @@
+package expresso
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// MsgPackMediaType is the media type of MessagePack responses.
+const MsgPackMediaType = "application/msgpack"
+
+// msgpackTimestamp is the extension type of MessagePack timestamps.
+const msgpackTimestamp = -1
+
+// MarshalMsgPack encodes v as MessagePack. Structs are encoded as maps keyed by their "json" tag
+// names, so MessagePack clients see the same fields as JSON clients; time.Time values use the
+// timestamp extension type and encoding.TextMarshaler values are encoded as strings.
+func MarshalMsgPack(v interface{}) ([]byte, error) {
+	e := &msgpackEncoder{}
+	if err := encodeValue(e, reflect.ValueOf(v)); err != nil {
+		return nil, fmt.Errorf("expresso: msgpack: %w", err)
+	}
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalMsgPack decodes MessagePack data into v, which must be a non-nil pointer.
+// Fields are matched by their "json" tag names, see MarshalMsgPack.
+func UnmarshalMsgPack(data []byte, v interface{}) error {
+	return decodeMsgPack(bytes.NewReader(data), v)
+}
+
+// decodeMsgPack reads a single MessagePack value from r into v, rejecting any data that follows it.
+func decodeMsgPack(r io.Reader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("expresso: msgpack: decode target must be a non-nil pointer, got %T", v)
+	}
+	d := &msgpackDecoder{r: bufio.NewReader(r)}
+	if _, err := d.r.Peek(1); errors.Is(err, io.EOF) {
+		return fmt.Errorf("expresso: msgpack: %w", err) // An empty document, rather than a truncated one.
+	}
+	src, err := d.decode(0)
+	if err != nil {
+		return err
+	}
+	if _, err := d.r.Peek(1); !errors.Is(err, io.EOF) {
+		if err == nil {
+			err = errors.New("unexpected data after top-level value")
+		}
+		return msgpackError(err)
+	}
+	return assignValue(rv.Elem(), src, "")
+}
+
+// msgpackEncoder writes MessagePack, using the smallest representation of each value.
+type msgpackEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *msgpackEncoder) encodeNil() { e.buf.WriteByte(0xc0) }
+
+func (e *msgpackEncoder) encodeBool(b bool) {
+	if b {
+		e.buf.WriteByte(0xc3)
+	} else {
+		e.buf.WriteByte(0xc2)
+	}
+}
+
+func (e *msgpackEncoder) encodeInt(i int64) {
+	switch {
+	case i >= 0:
+		e.encodeUint(uint64(i))
+	case i >= -32:
+		e.buf.WriteByte(byte(i)) // Negative fixint.
+	case i >= math.MinInt8:
+		e.buf.Write([]byte{0xd0, byte(i)})
+	case i >= math.MinInt16:
+		e.buf.WriteByte(0xd1)
+		e.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+	case i >= math.MinInt32:
+		e.buf.WriteByte(0xd2)
+		e.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	default:
+		e.buf.WriteByte(0xd3)
+		e.buf.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.buf.WriteByte(byte(u)) // Positive fixint.
+	case u <= math.MaxUint8:
+		e.buf.Write([]byte{0xcc, byte(u)})
+	case u <= math.MaxUint16:
+		e.buf.WriteByte(0xcd)
+		e.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(u)))
+	case u <= math.MaxUint32:
+		e.buf.WriteByte(0xce)
+		e.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(u)))
+	default:
+		e.buf.WriteByte(0xcf)
+		e.buf.Write(binary.BigEndian.AppendUint64(nil, u))
+	}
+}
+
+func (e *msgpackEncoder) encodeFloat32(f float32) {
+	e.buf.WriteByte(0xca)
+	e.buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(f)))
+}
+
+func (e *msgpackEncoder) encodeFloat64(f float64) {
+	e.buf.WriteByte(0xcb)
+	e.buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+func (e *msgpackEncoder) encodeString(s string) {
+	e.writeLen(len(s), 0xa0, 31, 0xd9, 0xda, 0xdb)
+	e.buf.WriteString(s)
+}
+
+func (e *msgpackEncoder) encodeBytes(b []byte) {
+	e.writeLen(len(b), 0, -1, 0xc4, 0xc5, 0xc6)
+	e.buf.Write(b)
+}
+
+func (e *msgpackEncoder) encodeArrayLen(n int) {
+	e.writeLen(n, 0x90, 15, 0, 0xdc, 0xdd)
+}
+
+func (e *msgpackEncoder) encodeMapLen(n int) {
+	e.writeLen(n, 0x80, 15, 0, 0xde, 0xdf)
+}
+
+// encodeTime writes the timestamp extension in its 32, 64 or 96 bit form.
+func (e *msgpackEncoder) encodeTime(t time.Time) {
+	sec, nsec := t.Unix(), uint32(t.Nanosecond())
+	switch {
+	case nsec == 0 && sec >= 0 && sec <= math.MaxUint32:
+		e.buf.Write([]byte{0xd6, 0xff}) // fixext 4
+		e.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(sec)))
+	case sec >= 0 && sec < 1<<34:
+		e.buf.Write([]byte{0xd7, 0xff}) // fixext 8
+		e.buf.Write(binary.BigEndian.AppendUint64(nil, uint64(nsec)<<34|uint64(sec)))
+	default:
+		e.buf.Write([]byte{0xc7, 12, 0xff}) // ext 8
+		e.buf.Write(binary.BigEndian.AppendUint32(nil, nsec))
+		e.buf.Write(binary.BigEndian.AppendUint64(nil, uint64(sec)))
+	}
+}
+
+// writeLen writes a length prefix: the fix form for lengths up to fixMax (if fixMax >= 0),
+// then the 8, 16 or 32 bit form. A zero code means the form does not exist for the type.
+func (e *msgpackEncoder) writeLen(n int, fix byte, fixMax int, code8, code16, code32 byte) {
+	switch {
+	case n <= fixMax:
+		e.buf.WriteByte(fix | byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		e.buf.Write([]byte{code8, byte(n)})
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(code16)
+		e.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		e.buf.WriteByte(code32)
+		e.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+// msgpackDecoder reads MessagePack values into generic values, see assignValue.
+type msgpackDecoder struct {
+	r *bufio.Reader
+}
+
+// decode reads the next value.
+func (d *msgpackDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, msgpackError(errDecodeDepth)
+	}
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return nil, msgpackError(err)
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.decodeString(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readLen(c - 0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return d.readBytes(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.readLen(c - 0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(n)
+	case 0xca:
+		u, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.readUint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.readUint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+		return u, nil
+	case 0xd0:
+		u, err := d.readUint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := d.readUint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := d.readUint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := d.readUint(8)
+		return int64(u), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readLen(c - 0xd9)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(n)
+	case 0xdc, 0xdd:
+		n, err := d.readLen(c - 0xdc + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.readLen(c - 0xde + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n, depth)
+	}
+	return nil, msgpackError(fmt.Errorf("invalid type byte 0x%02x", c))
+}
+
+// decodeArray reads n values.
+func (d *msgpackDecoder) decodeArray(n, depth int) (interface{}, error) {
+	items := make([]interface{}, 0, minInt(n, maxPrealloc))
+	for i := 0; i < n; i++ {
+		item, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// decodeMap reads n key/value pairs.
+func (d *msgpackDecoder) decodeMap(n, depth int) (interface{}, error) {
+	keys := make([]interface{}, 0, minInt(n, maxPrealloc))
+	values := make([]interface{}, 0, minInt(n, maxPrealloc))
+	for i := 0; i < n; i++ {
+		key, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	m, err := newDecodedMap(keys, values)
+	if err != nil {
+		return nil, msgpackError(err)
+	}
+	return m, nil
+}
+
+// decodeString reads a string of n bytes.
+func (d *msgpackDecoder) decodeString(n int) (interface{}, error) {
+	b, err := d.readBytes(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// decodeExt reads an extension value of n data bytes. Only timestamps are supported.
+func (d *msgpackDecoder) decodeExt(n int) (interface{}, error) {
+	typ, err := d.r.ReadByte()
+	if err != nil {
+		return nil, msgpackError(err)
+	}
+	data, err := d.readBytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) != msgpackTimestamp {
+		return nil, msgpackError(fmt.Errorf("unsupported extension type %d", int8(typ)))
+	}
+
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		u := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data)
+		sec := int64(binary.BigEndian.Uint64(data[4:]))
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	}
+	return nil, msgpackError(fmt.Errorf("invalid timestamp length %d", n))
+}
+
+// readLen reads a big-endian length of 1, 2 or 4 bytes, selected by size 0, 1 or 2.
+func (d *msgpackDecoder) readLen(size byte) (int, error) {
+	u, err := d.readUint(1 << size)
+	if err != nil {
+		return 0, err
+	}
+	return int(u), nil
+}
+
+// readUint reads a big-endian unsigned integer of n bytes.
+func (d *msgpackDecoder) readUint(n int) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(d.r, b[:n]); err != nil {
+		return 0, msgpackError(err)
+	}
+	var u uint64
+	for _, c := range b[:n] {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// readBytes reads n bytes, growing the buffer as data arrives rather than trusting n up front.
+func (d *msgpackDecoder) readBytes(n int) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(minInt(n, 64<<10))
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		return nil, msgpackError(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// msgpackError prefixes decoding errors, turning a premature end of input into io.ErrUnexpectedEOF.
+// Errors limiting the request body are returned as is, so Bind can reply 413.
+func msgpackError(err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return err
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("expresso: msgpack: %w", err)
+}
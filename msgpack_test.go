@@ -0,0 +1,278 @@
+package expresso
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// codecRecord exercises the json tag handling and types supported by the MessagePack and CBOR codecs.
+type codecRecord struct {
+	Name     string            `json:"name"`
+	Count    int               `json:"count"`
+	Negative int8              `json:"negative"`
+	Big      uint64            `json:"big"`
+	Ratio    float64           `json:"ratio"`
+	Small    float32           `json:"small"`
+	Active   bool              `json:"active"`
+	Data     []byte            `json:"data"`
+	Tags     []string          `json:"tags"`
+	Scores   map[string]int    `json:"scores"`
+	Nested   *codecChild       `json:"nested"`
+	Children []codecChild      `json:"children"`
+	Created  time.Time         `json:"created"`
+	Addr     netip.Addr        `json:"addr"`
+	Extra    map[string]string `json:"extra,omitempty"`
+	Secret   string            `json:"-"`
+	Untagged string
+}
+
+type codecChild struct {
+	ID    int     `json:"id"`
+	Label *string `json:"label"`
+}
+
+// sampleRecord returns a codecRecord with every field set, except those not meant to be encoded.
+func sampleRecord() codecRecord {
+	label := "first"
+	return codecRecord{
+		Name:     "gopher",
+		Count:    70000,
+		Negative: -100,
+		Big:      math.MaxUint64,
+		Ratio:    3.25,
+		Small:    1.5,
+		Active:   true,
+		Data:     []byte{0, 1, 2, 0xff},
+		Tags:     []string{"a", "b"},
+		Scores:   map[string]int{"x": 1, "y": -2},
+		Nested:   &codecChild{ID: 1, Label: &label},
+		Children: []codecChild{{ID: 2}, {ID: 3, Label: &label}},
+		Created:  time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC),
+		Addr:     netip.MustParseAddr("192.0.2.1"),
+		Untagged: "kept",
+	}
+}
+
+// mustHex decodes a hexadecimal test vector.
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMsgPackRoundTrip(t *testing.T) {
+	in := sampleRecord()
+	in.Secret = "dropped"
+	data, err := MarshalMsgPack(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out codecRecord
+	if err := UnmarshalMsgPack(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Secret = ""
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", out, in)
+	}
+
+	// Fields are keyed by their json names, skipping "-" and empty omitempty fields.
+	var generic map[string]interface{}
+	if err := UnmarshalMsgPack(data, &generic); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"name", "big", "nested", "created", "addr", "Untagged"} {
+		if _, ok := generic[key]; !ok {
+			t.Errorf("encoded map lacks key %q", key)
+		}
+	}
+	for _, key := range []string{"Secret", "-", "extra", "Name"} {
+		if _, ok := generic[key]; ok {
+			t.Errorf("encoded map has unexpected key %q", key)
+		}
+	}
+	if generic["addr"] != "192.0.2.1" {
+		t.Errorf("addr = %#v, want the TextMarshaler's string", generic["addr"])
+	}
+}
+
+func TestMsgPackTimestamps(t *testing.T) {
+	tests := []struct {
+		name   string
+		time   time.Time
+		prefix string
+	}{
+		{"32-bit", time.Unix(1700000000, 0), "d6 ff"},
+		{"64-bit", time.Unix(1700000000, 500), "d7 ff"},
+		{"64-bit beyond 2106", time.Unix(1<<33, 1), "d7 ff"},
+		{"96-bit before 1970", time.Unix(-1, 999999999), "c7 0c ff"},
+		{"96-bit beyond 2514", time.Unix(1<<34, 0), "c7 0c ff"},
+	}
+	for _, tt := range tests {
+		data, err := MarshalMsgPack(tt.time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prefix := mustHex(t, tt.prefix); !bytes.HasPrefix(data, prefix) {
+			t.Errorf("%s: encoded as % x, want prefix % x", tt.name, data, prefix)
+		}
+		var got time.Time
+		if err := UnmarshalMsgPack(data, &got); err != nil || !got.Equal(tt.time) {
+			t.Errorf("%s: decoded %v (%v), want %v", tt.name, got, err, tt.time)
+		}
+	}
+
+	// Vectors from the MessagePack specification's timestamp extension.
+	vectors := []struct {
+		data string
+		want time.Time
+	}{
+		{"d6 ff 00000000", time.Unix(0, 0)},
+		{"d7 ff 00000004 00000001", time.Unix(1, 1)},
+		{"c7 0c ff 00000001 ffffffffffffffff", time.Unix(-1, 1)},
+	}
+	for _, v := range vectors {
+		var got time.Time
+		if err := UnmarshalMsgPack(mustHex(t, v.data), &got); err != nil || !got.Equal(v.want) {
+			t.Errorf("% s: decoded %v (%v), want %v", v.data, got, err, v.want)
+		}
+	}
+}
+
+func TestMsgPackVectors(t *testing.T) {
+	tests := []struct {
+		data string
+		want interface{}
+	}{
+		{"00", int64(0)},
+		{"7f", int64(127)},
+		{"ff", int64(-1)},
+		{"e0", int64(-32)},
+		{"cc ff", int64(255)},
+		{"cd 0100", int64(256)},
+		{"cf ffffffffffffffff", uint64(math.MaxUint64)},
+		{"d0 80", int64(-128)},
+		{"d3 8000000000000000", int64(math.MinInt64)},
+		{"ca 3fc00000", 1.5},
+		{"cb 3ff199999999999a", 1.1},
+		{"c0", nil},
+		{"c2", false},
+		{"c3", true},
+		{"a3 616263", "abc"},
+		{"d9 03 616263", "abc"},
+		{"c4 02 0102", []byte{1, 2}},
+		{"93 01 02 03", []interface{}{int64(1), int64(2), int64(3)}},
+		{"dc 0002 01 02", []interface{}{int64(1), int64(2)}},
+		{"82 a1 61 01 a1 62 92 02 03", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{"81 01 02", map[interface{}]interface{}{int64(1): int64(2)}},
+	}
+	for _, tt := range tests {
+		var got interface{}
+		if err := UnmarshalMsgPack(mustHex(t, tt.data), &got); err != nil {
+			t.Errorf("% s: %v", tt.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("% s: decoded %#v, want %#v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestMsgPackMalformed(t *testing.T) {
+	valid, err := MarshalMsgPack(sampleRecord())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 1; n < len(valid); n++ {
+		var out codecRecord
+		if err := UnmarshalMsgPack(valid[:n], &out); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("truncated to %d of %d bytes: error = %v, want io.ErrUnexpectedEOF", n, len(valid), err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "EOF"},
+		{"trailing data", mustHex(t, "01 02"), "unexpected data after top-level value"},
+		{"invalid type byte", mustHex(t, "c1"), "invalid type byte 0xc1"},
+		{"unsupported extension", mustHex(t, "d4 05 00"), "unsupported extension type 5"},
+		{"invalid timestamp", mustHex(t, "d5 ff 0000"), "invalid timestamp length 2"},
+		{"depth limit", append(bytes.Repeat([]byte{0x91}, maxDecodeDepth+1), 0xc0), "nested too deeply"},
+		{"huge string", mustHex(t, "db ffffffff 61"), "unexpected EOF"},
+		{"huge binary", mustHex(t, "c6 ffffffff 61"), "unexpected EOF"},
+		{"huge array", mustHex(t, "dd ffffffff 01"), "unexpected EOF"},
+		{"huge map", mustHex(t, "df ffffffff 01 01"), "unexpected EOF"},
+		{"unhashable key", mustHex(t, "81 90 01"), "unsupported map key"},
+	}
+	for _, tt := range tests {
+		var out interface{}
+		err := UnmarshalMsgPack(tt.data, &out)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+
+	var count int
+	err = UnmarshalMsgPack(mustHex(t, "a3 616263"), &count)
+	var typeErr *codecTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("string into int: error = %v, want a codecTypeError", err)
+	}
+}
+
+func TestBindMsgPack(t *testing.T) {
+	app := newTestApp()
+	var got codecRecord
+	app.POST("/", func(ctx *Context) {
+		got = codecRecord{}
+		if err := ctx.Bind(&got); err != nil {
+			ctx.Fail(err)
+			return
+		}
+		ctx.SendStatus(http.StatusNoContent)
+	})
+
+	want := sampleRecord()
+	valid, _ := MarshalMsgPack(want)
+	wrongType, _ := MarshalMsgPack(map[string]interface{}{"count": "many"})
+	tests := []struct {
+		name string
+		body []byte
+		code int
+		msg  string
+	}{
+		{"valid", valid, http.StatusNoContent, ""},
+		{"empty", nil, http.StatusBadRequest, "malformed MessagePack body: empty body"},
+		{"truncated", valid[:len(valid)/2], http.StatusBadRequest, "malformed MessagePack body"},
+		{"trailing data", append(valid[:len(valid):len(valid)], 0xc0), http.StatusBadRequest, "unexpected data after top-level value"},
+		{"wrong type", wrongType, http.StatusBadRequest, `invalid MessagePack field \"count\"`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(tt.body))
+		req.Header.Set("Content-Type", MsgPackMediaType)
+		w := serve(app, req)
+		if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.msg) {
+			t.Errorf("%s: response = %d %s, want %d containing %q", tt.name, w.Code, w.Body.String(), tt.code, tt.msg)
+		}
+		if tt.code == http.StatusNoContent && !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: bound %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package expresso
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// mediaRange is an element of an Accept header, e.g. "text/*;q=0.8".
+type mediaRange struct {
+	typ, sub string
+	params   map[string]string // Parameters other than q, which the offer must match.
+	q        float64
+}
+
+// Negotiate returns the offered media type preferred by the client according to its Accept header,
+// following RFC 9110: each offer gets the q-value of the most specific media range matching it, and
+// ties go to the earlier offer. It returns the first offer if the request has no Accept header, and
+// "" if none of the offers is acceptable. Vary: Accept is added to the response, as it now depends on the header.
+//
+//	switch ctx.Negotiate("application/json", "text/csv") {
+//	case "application/json":
+//		...
+//	case "text/csv":
+//		...
+//	default:
+//		ctx.Fail(expresso.NewHTTPError(http.StatusNotAcceptable, "", nil))
+//	}
+func (c *Context) Negotiate(offers ...string) string {
+	if !headerContainsToken(c.Response.Headers, "Vary", "Accept") {
+		c.Response.Headers.Add("Vary", "Accept")
+	}
+	return negotiate(c.Request.Headers.Values("Accept"), offers)
+}
+
+// negotiate returns the offer with the highest q-value in the Accept header values, see Negotiate.
+func negotiate(accept []string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := quality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// parseAccept parses the media ranges of Accept header values, skipping malformed ones.
+func parseAccept(values []string) []mediaRange {
+	var ranges []mediaRange
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if strings.TrimSpace(part) == "" {
+				continue
+			}
+			mediaType, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				continue
+			}
+			typ, sub, ok := strings.Cut(mediaType, "/")
+			if !ok || typ == "*" && sub != "*" {
+				continue
+			}
+
+			r := mediaRange{typ: typ, sub: sub, q: 1}
+			if q, ok := params["q"]; ok {
+				parsed, err := strconv.ParseFloat(q, 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					parsed = 0
+				}
+				r.q = parsed
+				delete(params, "q")
+			}
+			r.params = params
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
+
+// quality returns the q-value of the most specific media range matching offer, or 0 if none does.
+func quality(ranges []mediaRange, offer string) float64 {
+	mediaType, params, err := mime.ParseMediaType(offer)
+	if err != nil {
+		return 0
+	}
+	typ, sub, _ := strings.Cut(mediaType, "/")
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		if r.typ != "*" && r.typ != typ || r.sub != "*" && r.sub != sub || !paramsMatch(r.params, params) {
+			continue
+		}
+		// "*/*" < "type/*" < "type/subtype" < "type/subtype;param=value"
+		s := len(r.params)
+		if r.typ != "*" {
+			s += 10
+		}
+		if r.sub != "*" {
+			s += 10
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+// paramsMatch reports whether every parameter of a media range is present, with the same value, in the offer.
+func paramsMatch(want, have map[string]string) bool {
+	for k, v := range want {
+		if !strings.EqualFold(have[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// formatOffer pairs a media type with the Formatted option sent for it.
+type formatOffer struct {
+	mediaType string
+	data      interface{}
+}
+
+// offers lists the media types of the options set on f, in order of preference: the options in field
+// order, the Custom options with a Renderer in renderers and then the type of Default, so an explicit
+// option wins over Default when both have the same type. XML, YAML and MessagePack are offered under
+// their alternative media types too.
+func (f Formatted) offers(renderers *rendererRegistry) []formatOffer {
+	var offers []formatOffer
+	if f.Text != nil {
+		offers = append(offers, formatOffer{"text/plain", f.Text})
+	}
+	if f.HTML != nil {
+		offers = append(offers, formatOffer{"text/html", f.HTML})
+	}
+	if f.JSON != nil {
+		offers = append(offers, formatOffer{"application/json", f.JSON})
+	}
+	if f.XML != nil {
+		offers = append(offers, formatOffer{"application/xml", f.XML}, formatOffer{"text/xml", f.XML})
+	}
+	if f.YAML != nil {
+		offers = append(offers,
+			formatOffer{"application/x-yaml", f.YAML},
+			formatOffer{"application/yaml", f.YAML},
+			formatOffer{"text/yaml", f.YAML})
+	}
+	if f.MsgPack != nil {
+		offers = append(offers,
+			formatOffer{MsgPackMediaType, f.MsgPack},
+			formatOffer{"application/x-msgpack", f.MsgPack},
+			formatOffer{"application/vnd.msgpack", f.MsgPack})
+	}
+	if f.CBOR != nil {
+		offers = append(offers, formatOffer{CBORMediaType, f.CBOR})
+	}
+	offers = append(offers, f.customOffers(renderers)...)
+	if f.Default != nil {
+		if mediaType := mediaTypeOf(f.Default); mediaType != "" {
+			offers = append(offers, formatOffer{mediaType, f.Default})
+		}
+	}
+	return offers
+}
+
+// mediaTypeOf returns the media type Send uses for a response value, or "" if unknown.
+func mediaTypeOf(data interface{}) string {
+	switch data := data.(type) {
+	case Text, *Text:
+		return "text/plain"
+	case HTML, *HTML:
+		return "text/html"
+	case JSON, *JSON:
+		return "application/json"
+	case XML, *XML:
+		return "application/xml"
+	case YAML, *YAML:
+		return "application/x-yaml"
+	case MsgPack, *MsgPack:
+		return MsgPackMediaType
+	case CBOR, *CBOR:
+		return CBORMediaType
+	case Template:
+		return data.contentType()
+	case *Template:
+		return data.contentType()
+	case File:
+		return data.ContentType
+	case *File:
+		return data.ContentType
+	case Rendered:
+		return baseMediaType(data.MediaType)
+	case *Rendered:
+		return baseMediaType(data.MediaType)
+	}
+	return ""
+}
+
+// notAcceptable replies 406 Not Acceptable in plain text, which every client can read.
+func (r Response) notAcceptable() {
+	r.Status(http.StatusNotAcceptable).Send(Text{Content: "406 - " + http.StatusText(http.StatusNotAcceptable)})
+}
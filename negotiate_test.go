@@ -0,0 +1,139 @@
+package expresso
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept []string
+		offers []string
+		want   string
+	}{
+		{nil, []string{"application/json", "text/html"}, "application/json"},
+		{[]string{"text/html"}, []string{"application/json", "text/html"}, "text/html"},
+		{[]string{"text/html;q=0.5, application/json"}, []string{"text/html", "application/json"}, "application/json"},
+		{[]string{"text/html;q=0.5", "application/json;q=0.8"}, []string{"text/html", "application/json"}, "application/json"},
+		// Ties go to the earlier offer.
+		{[]string{"text/html, application/json"}, []string{"application/json", "text/html"}, "application/json"},
+		{[]string{"*/*"}, []string{"text/html", "application/json"}, "text/html"},
+		// The most specific range sets the q-value, wherever it appears in the header.
+		{[]string{"text/html;q=0, text/*"}, []string{"text/html", "text/plain"}, "text/plain"},
+		{[]string{"text/*;q=0.2, */*;q=0.5, application/json;q=0.1"}, []string{"application/json", "text/plain", "image/png"}, "image/png"},
+		{[]string{"text/html;level=1, text/html;q=0.1"}, []string{"text/html", "text/html;level=1"}, "text/html;level=1"},
+		{[]string{"TEXT/HTML;Q=0.9, application/json;q=0.8"}, []string{"application/json", "text/html"}, "text/html"},
+		{[]string{"application/json;q=0"}, []string{"application/json"}, ""},
+		{[]string{"image/png"}, []string{"application/json", "text/html"}, ""},
+		// Malformed ranges are skipped; a header with none left counts as absent.
+		{[]string{"*/html, text/plain"}, []string{"application/json", "text/plain"}, "text/plain"},
+		{[]string{"text/plain;q=2"}, []string{"text/plain"}, ""},
+		{[]string{"garbage"}, []string{"application/json", "text/html"}, "application/json"},
+		{[]string{"text/html"}, nil, ""},
+	}
+	for _, tt := range tests {
+		if got := negotiate(tt.accept, tt.offers); got != tt.want {
+			t.Errorf("negotiate(%q, %q) = %q, want %q", tt.accept, tt.offers, got, tt.want)
+		}
+	}
+}
+
+func TestFormatted(t *testing.T) {
+	app := newTestApp()
+	app.GET("/", func(ctx *Context) {
+		ctx.Formatted(ctx.RawRequest, Formatted{
+			Text:    &Text{"text"},
+			JSON:    &JSON{Data: "json"},
+			Default: &JSON{Data: "default"},
+		})
+	})
+
+	tests := []struct {
+		accept string
+		body   string
+	}{
+		{"", `"default"`},
+		{"text/plain", "text"},
+		{"text/plain;q=0.5, application/json", `"json"`}, // The explicit option wins over Default of the same type.
+		{"*/*", `"default"`},                             // Matches of a wildcard alone tie with Default, which wins.
+		{"text/*", "text"},
+		{"text/plain, application/json", `"default"`}, // Default wins ties, as with */*.
+		{"text/plain, */*;q=0.1", "text"},
+		{"image/png", `"default"`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		w := serve(app, req)
+		if w.Code != http.StatusOK || w.Body.String() != tt.body {
+			t.Errorf("Accept %q: response = %d %q, want 200 %q", tt.accept, w.Code, w.Body.String(), tt.body)
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Accept %q: Vary = %q, want Accept", tt.accept, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestStrictNegotiation(t *testing.T) {
+	app := newTestApp()
+	app.Config.StrictNegotiation = true
+	app.GET("/", func(ctx *Context) {
+		ctx.Formatted(ctx.RawRequest, Formatted{JSON: &JSON{Data: "json"}, Default: &JSON{Data: "default"}})
+	})
+	app.GET("/error", func(ctx *Context) {
+		ctx.Fail(NewHTTPError(http.StatusConflict, "conflict", nil))
+	})
+	app.GET("/invalid", func(ctx *Context) {
+		ctx.Fail(Validate(&struct {
+			Name string `validate:"required"`
+		}{}))
+	})
+	app.GET("/panic", func(ctx *Context) {
+		panic("boom")
+	})
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/", http.StatusNotAcceptable},
+		// Error responses keep their status, sent in the Default format.
+		{"/error", http.StatusConflict},
+		{"/invalid", http.StatusUnprocessableEntity},
+		{"/panic", http.StatusInternalServerError},
+		{"/missing", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept", "image/png")
+		w := serve(app, req)
+		if w.Code != tt.code {
+			t.Errorf("GET %s: status = %d, want %d", tt.path, w.Code, tt.code)
+		}
+		if tt.code != http.StatusNotAcceptable && w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("GET %s: Content-Type = %q, want application/json", tt.path, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestFormattedAnyType(t *testing.T) {
+	app := newTestApp()
+	for _, accept := range []string{"", "*/*", "text/*;q=0.5, */*", "application/json, text/plain"} {
+		req := httptest.NewRequest("GET", "/missing", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := serve(app, req)
+		if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("Accept %q: response = %d %s, want a 404 in the Default JSON", accept, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+	req := httptest.NewRequest("GET", "/missing", nil)
+	req.Header.Set("Accept", "text/plain")
+	if w := serve(app, req); w.Header().Get("Content-Type") != "text/plain" || w.Body.String() != "404 - Not Found" {
+		t.Errorf("Accept text/plain: response = %s %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
@@ -0,0 +1,148 @@
+package expresso
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// responseRecorder wraps the http.ResponseWriter of a request to track what was actually sent:
+// the status code, the number of body bytes and whether the headers were written. Middleware
+// replacing Response's writer, e.g. to compress the body, wrap the recorder so it still sees the
+// bytes that reach the client.
+type responseRecorder struct {
+	http.ResponseWriter
+	pending     int     // Status set with Response.Status, sent with the headers.
+	status      int     // Status code sent, zero until the headers are written.
+	size        int64   // Number of body bytes written.
+	wroteHeader bool    // Whether the headers were sent, or committed by a writer holding them back.
+	heldBack    bool    // Whether the committed headers are still held back by a writer wrapping the recorder, see commit.
+	logger      *Logger // Receives the status code and warnings, nil until the Context is created.
+}
+
+// WriteHeader sends the headers with the status code, ignoring and warning about further calls.
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.heldBack {
+		// The headers committed earlier are now sent, possibly with another status, e.g. on an encoding error.
+		r.heldBack = false
+		r.record(code)
+		r.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if r.wroteHeader {
+		r.warn(fmt.Sprintf("superfluous WriteHeader with status %d, headers were already sent with status %d", code, r.status))
+		return
+	}
+	r.wroteHeader = true
+	r.record(code)
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// commit records the status of a response whose headers a writer wrapping the recorder, such as the
+// compression middleware, holds back until it has seen enough of the body. The response then counts
+// as written: HeadersSent reports true and ResponseStatus returns code, as they would without the wrapper.
+func (r *responseRecorder) commit(code int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.heldBack = true
+	r.record(code)
+}
+
+// record stores the status code sent to the client.
+func (r *responseRecorder) record(code int) {
+	r.status = code
+	if r.logger != nil {
+		r.logger.StatusCode = code
+	}
+}
+
+// Write writes body bytes, sending the headers first with the pending status, or 200, if needed.
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.heldBack {
+		r.WriteHeader(r.status)
+	} else if !r.wroteHeader {
+		r.WriteHeader(r.statusOrOK())
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+// Flush sends buffered data to the client if the underlying writer supports it.
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		if r.heldBack {
+			r.WriteHeader(r.status)
+		} else if !r.wroteHeader {
+			r.WriteHeader(r.statusOrOK())
+		}
+		flusher.Flush()
+	}
+}
+
+// Hijack takes over the connection, recording 101 Switching Protocols as the status.
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("expresso: hijacking is not supported by the response writer")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		r.wroteHeader = true
+		r.heldBack = false
+		r.record(http.StatusSwitchingProtocols)
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for use by http.ResponseController.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// statusOrOK returns the pending status, or 200 if none was set.
+func (r *responseRecorder) statusOrOK() int {
+	if r.pending == 0 {
+		return http.StatusOK
+	}
+	return r.pending
+}
+
+// warn logs a warning about misuse of the response.
+func (r *responseRecorder) warn(message string) {
+	if r.logger != nil {
+		r.logger.Warn(message)
+	}
+}
+
+// ResponseStatus returns the status code sent to the client, or 0 if the headers have not been sent yet.
+func (r Response) ResponseStatus() int {
+	return r.rec.status
+}
+
+// ResponseSize returns the number of body bytes written to the client.
+func (r Response) ResponseSize() int64 {
+	return r.rec.size
+}
+
+// HeadersSent reports whether the status code and headers have been sent, after which
+// they can no longer be changed.
+func (r Response) HeadersSent() bool {
+	return r.rec.wroteHeader
+}
+
+// canFlush reports whether w, or the writer it wraps, supports flushing.
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		if unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+			w = unwrapper.Unwrap()
+			continue
+		}
+		_, ok := w.(http.Flusher)
+		return ok
+	}
+}
@@ -0,0 +1,166 @@
+package expresso
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newTestRecorder returns a recorder over an httptest.ResponseRecorder, logging to a new Logger.
+func newTestRecorder() (*responseRecorder, *httptest.ResponseRecorder, *Logger) {
+	w := httptest.NewRecorder()
+	logger := NewLogger(&Request{Path: &url.URL{Path: "/"}, Method: "GET"})
+	return &responseRecorder{ResponseWriter: w, logger: logger}, w, logger
+}
+
+// warnings returns the messages of the warnings logged to logger.
+func warnings(logger *Logger) []string {
+	var messages []string
+	for _, log := range logger.logs {
+		if log.Level == LogLevelWarn {
+			messages = append(messages, log.Message)
+		}
+	}
+	return messages
+}
+
+func TestRecorderCounts(t *testing.T) {
+	rec, w, logger := newTestRecorder()
+	rec.pending = http.StatusAccepted
+
+	// The first write sends the headers with the pending status.
+	rec.Write([]byte("hello, "))
+	rec.Write([]byte("world"))
+
+	if rec.status != http.StatusAccepted || w.Code != http.StatusAccepted || logger.StatusCode != http.StatusAccepted {
+		t.Errorf("status = %d, sent %d, logged %d, want 202", rec.status, w.Code, logger.StatusCode)
+	}
+	if rec.size != 12 || w.Body.String() != "hello, world" {
+		t.Errorf("size = %d, body %q, want 12 %q", rec.size, w.Body, "hello, world")
+	}
+	if !rec.wroteHeader {
+		t.Error("wroteHeader = false after a write")
+	}
+	if len(warnings(logger)) != 0 {
+		t.Errorf("warnings = %q, want none", warnings(logger))
+	}
+}
+
+func TestRecorderDefaultsTo200(t *testing.T) {
+	rec, w, _ := newTestRecorder()
+	if rec.status != 0 {
+		t.Errorf("status = %d before writing, want 0", rec.status)
+	}
+	rec.Flush()
+	if rec.status != http.StatusOK || w.Code != http.StatusOK || !w.Flushed {
+		t.Errorf("status = %d, sent %d, flushed %v, want 200 and flushed", rec.status, w.Code, w.Flushed)
+	}
+}
+
+func TestRecorderSuperfluousWriteHeader(t *testing.T) {
+	rec, w, logger := newTestRecorder()
+	rec.WriteHeader(http.StatusCreated)
+	rec.WriteHeader(http.StatusInternalServerError)
+
+	if rec.status != http.StatusCreated || w.Code != http.StatusCreated {
+		t.Errorf("status = %d, sent %d, want the first status 201", rec.status, w.Code)
+	}
+	got := warnings(logger)
+	if len(got) != 1 || !strings.Contains(got[0], "superfluous WriteHeader with status 500") || !strings.Contains(got[0], "status 201") {
+		t.Errorf("warnings = %q, want one superfluous WriteHeader warning", got)
+	}
+}
+
+func TestRecorderHeldBack(t *testing.T) {
+	rec, w, _ := newTestRecorder()
+
+	// A wrapping writer commits the status without sending the headers yet.
+	rec.commit(http.StatusCreated)
+	if !rec.wroteHeader || rec.status != http.StatusCreated || w.Code != http.StatusOK || len(w.Header()) != 0 {
+		t.Fatalf("after commit: wroteHeader %v, status %d, want committed 201 and nothing sent", rec.wroteHeader, rec.status)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("body = %q after commit, want nothing sent", w.Body)
+	}
+
+	// It may still send the headers with another status, once.
+	rec.WriteHeader(http.StatusInternalServerError)
+	rec.Write([]byte("oops"))
+	if rec.status != http.StatusInternalServerError || w.Code != http.StatusInternalServerError || w.Body.String() != "oops" {
+		t.Errorf("status = %d, sent %d %q, want 500 %q", rec.status, w.Code, w.Body, "oops")
+	}
+}
+
+func TestResponseWarnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler Middleware
+		status  int
+		body    string
+		warning string
+	}{
+		{"Send after commit", func(ctx *Context) {
+			ctx.Send(Text{Content: "first"})
+			ctx.Send(Text{Content: "second"})
+		}, 200, "first", "Send called after the response was already written"},
+		{"Status after commit", func(ctx *Context) {
+			ctx.SendStatus(204)
+			ctx.Status(500)
+		}, 204, "", "Status(500) called after the headers were sent with status 204"},
+		{"superfluous SendStatus", func(ctx *Context) {
+			ctx.SendStatus(204)
+			ctx.SendStatus(500)
+		}, 204, "", "superfluous WriteHeader with status 500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp()
+			var logger *Logger
+			app.GET("/", func(ctx *Context) {
+				logger = ctx.Logger
+				tt.handler(ctx)
+			})
+
+			w := serve(app, httptest.NewRequest("GET", "/", nil))
+			if w.Code != tt.status || w.Body.String() != tt.body {
+				t.Errorf("got %d %q, want %d %q", w.Code, w.Body, tt.status, tt.body)
+			}
+			got := warnings(logger)
+			if len(got) != 1 || !strings.Contains(got[0], tt.warning) {
+				t.Errorf("warnings = %q, want one containing %q", got, tt.warning)
+			}
+		})
+	}
+}
+
+func TestResponseStatus(t *testing.T) {
+	app := newTestApp()
+	var before, after int
+	var sentBefore, sentAfter bool
+	var size int64
+	app.GET("/", func(ctx *Context) {
+		ctx.Status(http.StatusTeapot)
+		before, sentBefore = ctx.ResponseStatus(), ctx.HeadersSent()
+		ctx.Send(Text{Content: "short and stout"})
+		after, sentAfter, size = ctx.ResponseStatus(), ctx.HeadersSent(), ctx.ResponseSize()
+	})
+
+	w := serve(app, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("status = %d, want 418", w.Code)
+	}
+	// Status only records the code to send; it does not set a header.
+	for name := range w.Header() {
+		if strings.EqualFold(name, "Status") {
+			t.Errorf("response has a %s header, want none", name)
+		}
+	}
+	if before != 0 || sentBefore {
+		t.Errorf("before Send: ResponseStatus %d, HeadersSent %v, want 0 and false", before, sentBefore)
+	}
+	if after != http.StatusTeapot || !sentAfter || size != int64(len("short and stout")) {
+		t.Errorf("after Send: ResponseStatus %d, HeadersSent %v, ResponseSize %d, want 418, true and 15", after, sentAfter, size)
+	}
+}
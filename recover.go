@@ -0,0 +1,109 @@
+package expresso
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// PanicHandler handles a panic recovered while processing a request. It receives the request's
+// Context, the value passed to panic and the stack trace of the panicking goroutine.
+type PanicHandler func(ctx *Context, recovered interface{}, stack []byte)
+
+// OnPanic sets the handler called when a middleware or handler panics. By default DefaultPanicHandler is used.
+func (a *App) OnPanic(handler PanicHandler) {
+	a.onPanic = handler
+}
+
+// DefaultPanicHandler logs the panic and its stack trace through the request's Logger and replies
+// with a Formatted 500. In development mode, see Config.Development, HTML clients get a page with
+// the stack trace and request details, and the other formats include the panic and stack trace.
+func DefaultPanicHandler(ctx *Context, recovered interface{}, stack []byte) {
+	ctx.Error(fmt.Sprintf("panic: %v\n%s", recovered, stack))
+
+	formatted := errorFormatted(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	if ctx.development {
+		data := map[string]interface{}{
+			"status": http.StatusInternalServerError,
+			"error":  http.StatusText(http.StatusInternalServerError),
+			"panic":  fmt.Sprint(recovered),
+			"stack":  string(stack),
+		}
+		formatted.Text = &Text{fmt.Sprintf("500 - panic: %v\n\n%s", recovered, stack)}
+		formatted.HTML = &HTML{debugPage(ctx, recovered, stack)}
+		formatted.JSON = &JSON{Data: data}
+		formatted.YAML = &YAML{Data: data}
+		formatted.MsgPack = &MsgPack{Data: data}
+		formatted.CBOR = &CBOR{Data: data}
+		formatted.Default = &JSON{Data: data}
+	}
+	ctx.Status(http.StatusInternalServerError).formatted(ctx.RawRequest, formatted, false)
+}
+
+// runRecovered executes the middleware chain, passing a panic to the App's panic handler.
+func (c *Context) runRecovered() {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		if recovered == http.ErrAbortHandler {
+			panic(recovered) // Let net/http abort the response as intended.
+		}
+
+		c.Abort()
+		c.halted = true
+		if c.onPanic != nil {
+			c.onPanic(c, recovered, debug.Stack())
+			return
+		}
+		DefaultPanicHandler(c, recovered, debug.Stack())
+	}()
+	c.run()
+}
+
+// redactedHeaders lists the canonical names of request headers carrying credentials, whose values
+// are hidden on the development panic page as it tends to end up in bug reports and screenshots.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+}
+
+// debugPage renders the development mode error page for a panic.
+func debugPage(ctx *Context, recovered interface{}, stack []byte) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html><html><head><title>500 - panic</title><style>")
+	b.WriteString("body{font-family:sans-serif;margin:2em}pre{background:#f4f4f4;padding:1em;overflow:auto}")
+	b.WriteString("td{padding:.2em 1em .2em 0;vertical-align:top;font-family:monospace}</style></head><body>")
+	fmt.Fprintf(&b, "<h1>panic: %s</h1>", html.EscapeString(fmt.Sprint(recovered)))
+	fmt.Fprintf(&b, "<h2>%s %s</h2>", html.EscapeString(ctx.Request.Method), html.EscapeString(ctx.Request.Path.String()))
+	fmt.Fprintf(&b, "<h3>Stack trace</h3><pre>%s</pre>", html.EscapeString(string(stack)))
+
+	if len(ctx.Params) > 0 {
+		b.WriteString("<h3>Route parameters</h3><table>")
+		for _, p := range ctx.Params {
+			fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td></tr>", html.EscapeString(p.Key), html.EscapeString(p.Value))
+		}
+		b.WriteString("</table>")
+	}
+
+	b.WriteString("<h3>Headers</h3><table>")
+	names := make([]string, 0, len(ctx.Request.Headers))
+	for name := range ctx.Request.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(ctx.Request.Headers[name], ", ")
+		if redactedHeaders[name] {
+			value = "[redacted]"
+		}
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td></tr>", html.EscapeString(name), html.EscapeString(value))
+	}
+	b.WriteString("</table></body></html>")
+	return b.String()
+}
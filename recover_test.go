@@ -0,0 +1,72 @@
+package expresso
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPanicRecovered(t *testing.T) {
+	app := newTestApp()
+	app.GET("/boom", func(ctx *Context) {
+		panic("secret detail")
+	})
+
+	req := httptest.NewRequest("GET", "/boom", nil)
+	req.Header.Set("Accept", "application/json")
+	w := serve(app, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "secret detail") {
+		t.Errorf("body %q exposes the panic outside development mode", w.Body.String())
+	}
+}
+
+func TestPanicDebugPageRedactsCredentials(t *testing.T) {
+	app := newTestApp()
+	app.Config.Development = true
+	app.GET("/boom", func(ctx *Context) {
+		panic("<kaboom>")
+	})
+
+	req := httptest.NewRequest("GET", "/boom", nil)
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Authorization", "Bearer token-123")
+	req.Header.Set("Proxy-Authorization", "Basic cHJveHk=")
+	req.Header.Set("Cookie", "session=cookie-456")
+	req.Header.Set("X-Trace", "visible-789")
+	w := serve(app, req)
+
+	body := w.Body.String()
+	if w.Code != http.StatusInternalServerError || !strings.Contains(body, "panic: &lt;kaboom&gt;") {
+		t.Fatalf("status = %d, body = %q", w.Code, body)
+	}
+	for _, secret := range []string{"token-123", "cHJveHk=", "cookie-456"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("debug page exposes %q", secret)
+		}
+	}
+	if !strings.Contains(body, "visible-789") || !strings.Contains(body, "[redacted]") {
+		t.Errorf("debug page lacks the request headers: %q", body)
+	}
+}
+
+func TestOnPanic(t *testing.T) {
+	app := newTestApp()
+	var got interface{}
+	app.OnPanic(func(ctx *Context, recovered interface{}, stack []byte) {
+		got = recovered
+		ctx.Status(http.StatusServiceUnavailable).Send(Text{Content: "custom"})
+	})
+	app.GET("/boom", func(ctx *Context) {
+		panic(42)
+	})
+
+	w := serve(app, httptest.NewRequest("GET", "/boom", nil))
+	if got != 42 || w.Code != http.StatusServiceUnavailable || w.Body.String() != "custom" {
+		t.Fatalf("recovered %v, response %d %q", got, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,110 @@
+package expresso
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"sync"
+)
+
+// Renderer encodes response data into a media type, see App.RegisterRenderer.
+type Renderer interface {
+	Render(w io.Writer, data interface{}) error
+}
+
+// RendererFunc adapts a function to the Renderer interface.
+type RendererFunc func(w io.Writer, data interface{}) error
+
+// Render calls f(w, data).
+func (f RendererFunc) Render(w io.Writer, data interface{}) error {
+	return f(w, data)
+}
+
+// Rendered is response data encoded by the Renderer registered for MediaType, e.g.
+//
+//	ctx.Send(expresso.Rendered{MediaType: "text/csv", Data: rows})
+type Rendered struct {
+	MediaType string      // The media type whose Renderer encodes Data, e.g. "text/csv".
+	Data      interface{} // The data passed to the Renderer.
+}
+
+// registeredRenderer is a Renderer with the Content-Type its output is sent with.
+type registeredRenderer struct {
+	contentType string
+	renderer    Renderer
+}
+
+// rendererRegistry holds the Renderers registered with App.RegisterRenderer, shared by the App and
+// its requests. It is guarded by a mutex, as renderers may be registered while requests are served.
+type rendererRegistry struct {
+	mu        sync.RWMutex
+	renderers map[string]registeredRenderer // Keyed by media type without parameters.
+}
+
+// RegisterRenderer adds a Renderer for a media type, such as "text/csv" or "application/x-protobuf",
+// replacing any renderer registered for it. The media type may carry parameters, e.g.
+// "text/csv; charset=utf-8", which are included in the Content-Type header but ignored when matching.
+// Rendered values with the media type can then be passed to Send, and to Formatted through its Custom
+// options, where they take part in content negotiation. It is safe to call while the App is serving.
+func (a *App) RegisterRenderer(mediaType string, renderer Renderer) {
+	a.renderers.mu.Lock()
+	defer a.renderers.mu.Unlock()
+	if a.renderers.renderers == nil {
+		a.renderers.renderers = map[string]registeredRenderer{}
+	}
+	a.renderers.renderers[baseMediaType(mediaType)] = registeredRenderer{contentType: mediaType, renderer: renderer}
+}
+
+// lookup returns the Renderer registered for mediaType, ignoring its parameters.
+func (r *rendererRegistry) lookup(mediaType string) (registeredRenderer, bool) {
+	if r == nil {
+		return registeredRenderer{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	registered, ok := r.renderers[baseMediaType(mediaType)]
+	return registered, ok
+}
+
+// render encodes data with the Renderer registered for its media type, setting the Content-Type header.
+func (r Response) render(data Rendered) ([]byte, error) {
+	registered, ok := r.Context.renderers.lookup(data.MediaType)
+	if !ok {
+		return nil, fmt.Errorf("expresso: no renderer registered for %q, see App.RegisterRenderer", data.MediaType)
+	}
+
+	var buf bytes.Buffer
+	if err := registered.renderer.Render(&buf, data.Data); err != nil {
+		return nil, err
+	}
+	r.w.Header().Set("Content-Type", registered.contentType)
+	return buf.Bytes(), nil
+}
+
+// customOffers returns the Custom options of f with a Renderer in renderers, in a stable order sorted
+// by media type. Options without a renderer are left out, as they could not be sent.
+func (f Formatted) customOffers(renderers *rendererRegistry) []formatOffer {
+	mediaTypes := make([]string, 0, len(f.Custom))
+	for mediaType := range f.Custom {
+		if _, ok := renderers.lookup(mediaType); ok {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+	}
+	sort.Strings(mediaTypes)
+
+	offers := make([]formatOffer, 0, len(mediaTypes))
+	for _, mediaType := range mediaTypes {
+		offers = append(offers, formatOffer{baseMediaType(mediaType), Rendered{MediaType: mediaType, Data: f.Custom[mediaType]}})
+	}
+	return offers
+}
+
+// baseMediaType returns the lowercase media type without parameters, e.g. "text/csv" for "Text/CSV; charset=utf-8".
+func baseMediaType(mediaType string) string {
+	if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+		return parsed
+	}
+	return mediaType
+}
@@ -0,0 +1,104 @@
+package expresso
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// csvRenderer writes a slice of rows as comma separated lines.
+var csvRenderer = RendererFunc(func(w io.Writer, data interface{}) error {
+	for _, row := range data.([][]string) {
+		if _, err := fmt.Fprintln(w, strings.Join(row, ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+})
+
+func TestRendered(t *testing.T) {
+	app := newTestApp()
+	app.RegisterRenderer("text/csv; charset=utf-8", csvRenderer)
+	app.GET("/", func(ctx *Context) {
+		ctx.Send(Rendered{MediaType: "TEXT/CSV", Data: [][]string{{"a", "b"}, {"1", "2"}}})
+	})
+	app.GET("/unregistered", func(ctx *Context) {
+		ctx.Send(Rendered{MediaType: "application/x-protobuf", Data: nil})
+	})
+
+	w := serve(app, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "a,b\n1,2\n" {
+		t.Errorf("response = %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want the registered type with its parameters", got)
+	}
+
+	if w := serve(app, httptest.NewRequest("GET", "/unregistered", nil)); w.Code != http.StatusInternalServerError {
+		t.Errorf("unregistered media type: status = %d, want 500", w.Code)
+	}
+}
+
+func TestFormattedCustom(t *testing.T) {
+	app := newTestApp()
+	app.RegisterRenderer("text/csv", csvRenderer)
+	app.GET("/", func(ctx *Context) {
+		ctx.Formatted(ctx.RawRequest, Formatted{
+			JSON: &JSON{Data: "json"},
+			Custom: map[string]interface{}{
+				"text/csv":               [][]string{{"csv"}},
+				"application/x-protobuf": "no renderer",
+			},
+		})
+	})
+
+	tests := []struct {
+		accept string
+		body   string
+	}{
+		{"text/csv", "csv\n"},
+		{"text/csv;q=0.5, application/json", `"json"`},
+		// Options without a renderer are not offered, rather than failing with a 500.
+		{"application/x-protobuf, application/json;q=0.1", `"json"`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		w := serve(app, req)
+		if w.Code != http.StatusOK || w.Body.String() != tt.body {
+			t.Errorf("Accept %q: response = %d %q, want 200 %q", tt.accept, w.Code, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestRegisterRendererWhileServing(t *testing.T) {
+	app := newTestApp()
+	app.GET("/", func(ctx *Context) {
+		ctx.Formatted(ctx.RawRequest, Formatted{
+			JSON:   &JSON{Data: "json"},
+			Custom: map[string]interface{}{"text/csv": [][]string{{"csv"}}},
+		})
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			app.RegisterRenderer("text/csv", csvRenderer)
+		}()
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept", "text/csv, application/json;q=0.5")
+			if w := serve(app, req); w.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200", w.Code)
+			}
+		}()
+	}
+	wg.Wait()
+}
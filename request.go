@@ -1,11 +1,8 @@
 package expresso
 
 import (
-	"errors"
-	"io"
 	"net/http"
 	"net/url"
-	"slices"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
@@ -19,13 +16,17 @@ type Request struct {
 	Path        *url.URL          // The URL path of the request.
 	Method      string            // The HTTP method used for the request (e.g., GET, POST).
 	Headers     http.Header       // The headers included in the request.
-	Body        []byte            // The body of the request as a byte slice.
+	Body        []byte            // The body of the request, nil until read with Context.BodyBytes.
 	Params      httprouter.Params // The URL parameters extracted from the request path.
-	QueryParams url.Values        // The query parameters parsed from the URL.
+	QueryParams url.Values        // The query parameters parsed from the URL, merged with url-encoded form fields.
+
+	bodyConsumed bool  // Whether the body was streamed with Context.BodyReader.
+	formErr      error // Error from parsing a url-encoded form body, returned by Bind.
 }
 
 // requestFromHttpRequest creates a new Request object from an http.Request.
-// It reads the request body and parses it into a byte slice, along with other request details.
+// The body is left unread, see Context.BodyReader and Context.BodyBytes, except for url-encoded
+// forms whose fields are merged into the query parameters.
 func requestFromHttpRequest(r *http.Request) *Request {
 	req := &Request{
 		RawRequest:  r,
@@ -37,16 +38,13 @@ func requestFromHttpRequest(r *http.Request) *Request {
 
 	cType := strings.Split(r.Header.Get("Content-Type"), ";")[0]
 
-	if slices.Contains([]string{"application/json", "application/xml"}, cType) {
-		// Read the body into the byte slice.
-		if bs, err := io.ReadAll(r.Body); err == nil || errors.Is(err, io.EOF) {
-			req.Body = bs
-		}
-	} else if cType == "application/x-www-form-urlencoded" {
+	if cType == "application/x-www-form-urlencoded" {
 		// Parse the form data into the query parameters.
 		if err := r.ParseForm(); err == nil {
 			req.QueryParams = r.Form
+		} else {
+			req.formErr = err
 		}
 	}
-	return req // Return nil if the body could not be read.
+	return req
 }
@@ -0,0 +1,132 @@
+package expresso
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// DefaultRequestIDHeader is the header carrying the request ID when RequestIDOptions.Header is empty.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest incoming request ID accepted by the default validation.
+const maxRequestIDLength = 128
+
+// RequestIDOptions configures the middleware returned by NewRequestIDMiddleware.
+type RequestIDOptions struct {
+	Header    string            // Header read from the request and echoed in the response, DefaultRequestIDHeader if empty.
+	Generator func() string     // Generates IDs for requests without a valid one, NewUUID if nil.
+	Validate  func(string) bool // Reports whether an incoming ID is accepted, see ValidRequestID for the default.
+}
+
+// NewRequestIDMiddleware returns a middleware assigning an ID to every request. An ID sent by the
+// client or an upstream service in the configured header is kept if valid, otherwise a new one is
+// generated. The ID is available with Context.RequestID, echoed in the response header and attached
+// to every log entry of the request as "request_id". Register it with App.Use, before other middleware.
+func NewRequestIDMiddleware(opts RequestIDOptions) Middleware {
+	header := opts.Header
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+	generate := opts.Generator
+	if generate == nil {
+		generate = NewUUID
+	}
+	validate := opts.Validate
+	if validate == nil {
+		validate = ValidRequestID
+	}
+
+	return func(ctx *Context) {
+		id := ctx.Request.Headers.Get(header)
+		if id == "" || !validate(id) {
+			id = generate()
+		}
+
+		ctx.requestID = id
+		ctx.Response.Headers.Set(header, id)
+		ctx.With("request_id", id)
+		ctx.Next()
+	}
+}
+
+// RequestID returns the ID assigned to the request by the request ID middleware, or "" if it is not in use.
+func (c *Context) RequestID() string {
+	return c.requestID
+}
+
+// ValidRequestID reports whether id is an acceptable incoming request ID: at most 128 characters,
+// all of them letters, digits or one of "-", "_", ".", ":" and "+", so it is safe to log and echo.
+func ValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '+':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewUUID returns a random version 4 UUID as defined by RFC 9562, e.g. "f47ac10b-58cc-4372-a567-0e02b2c3d479".
+func NewUUID() string {
+	var b [16]byte
+	randomBytes(b[:])
+	b[6] = b[6]&0x0f | 0x40 // Version 4.
+	b[8] = b[8]&0x3f | 0x80 // Variant 10.
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a ULID: 26 characters encoding a millisecond timestamp followed by 80 random bits,
+// so that IDs sort by creation time, e.g. "01ARZ3NDEKTSV4RRFFQ69G5FAV".
+func NewULID() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+	randomBytes(b[6:])
+
+	// Encode the 128 bits as 26 groups of 5 bits, the first group holding only the top 3 bits.
+	var s [26]byte
+	var acc uint32
+	bits := 2 // 130 encoded bits minus 128 data bits: the first character is padded with 2 zero bits.
+	n := 0
+	for _, v := range b {
+		acc = acc<<8 | uint32(v)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			s[n] = crockford[acc>>uint(bits)&0x1f]
+			n++
+		}
+	}
+	return string(s[:])
+}
+
+// randomBytes fills b from the system's secure random number generator.
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic("expresso: reading random bytes: " + err.Error())
+	}
+}
@@ -0,0 +1,143 @@
+package expresso
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewUUID(t *testing.T) {
+	format := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := NewUUID()
+		if !format.MatchString(id) {
+			t.Fatalf("NewUUID() = %q, want a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("NewUUID() returned %q twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	format := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	before := time.Now().UnixMilli()
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := NewULID()
+		if !format.MatchString(id) {
+			t.Fatalf("NewULID() = %q, want 26 Crockford base32 characters", id)
+		}
+		if seen[id] {
+			t.Fatalf("NewULID() returned %q twice", id)
+		}
+		seen[id] = true
+
+		// The first 10 characters encode the creation time in milliseconds.
+		var ms int64
+		for _, c := range id[:10] {
+			ms = ms<<5 | int64(strings.IndexRune(crockford, c))
+		}
+		if ms < before || ms > time.Now().UnixMilli() {
+			t.Fatalf("NewULID() = %q encodes time %d, want between %d and now", id, ms, before)
+		}
+	}
+
+	// IDs sort by creation time.
+	first := NewULID()
+	time.Sleep(2 * time.Millisecond)
+	if second := NewULID(); second <= first {
+		t.Errorf("NewULID() = %q after %q, want it to sort later", second, first)
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"f47ac10b-58cc-4372-a567-0e02b2c3d479", true},
+		{"01ARZ3NDEKTSV4RRFFQ69G5FAV", true},
+		{"trace:span_1.2+retry", true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+		{"", false},
+		{"has space", false},
+		{"line\nbreak", false},
+		{`quote"`, false},
+		{"<script>", false},
+		{"café", false},
+	}
+	for _, tt := range tests {
+		if got := ValidRequestID(tt.id); got != tt.want {
+			t.Errorf("ValidRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	const generated = "generated"
+	tests := []struct {
+		name     string
+		opts     RequestIDOptions
+		header   string // The header carrying the ID.
+		incoming string
+		want     string
+	}{
+		{"generated", RequestIDOptions{}, DefaultRequestIDHeader, "", ""},
+		{"trusted", RequestIDOptions{}, DefaultRequestIDHeader, "upstream-42", "upstream-42"},
+		{"too long", RequestIDOptions{}, DefaultRequestIDHeader, strings.Repeat("a", 129), ""},
+		{"invalid characters", RequestIDOptions{}, DefaultRequestIDHeader, "a b\"c", ""},
+		{"custom header", RequestIDOptions{Header: "X-Correlation-ID"}, "X-Correlation-ID", "upstream-42", "upstream-42"},
+		{"custom generator", RequestIDOptions{Generator: func() string { return generated }}, DefaultRequestIDHeader, "", generated},
+		{"custom validation", RequestIDOptions{
+			Generator: func() string { return generated },
+			Validate:  func(id string) bool { return strings.HasPrefix(id, "svc-") },
+		}, DefaultRequestIDHeader, "upstream-42", generated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp()
+			app.Use(NewRequestIDMiddleware(tt.opts))
+			var id string
+			app.GET("/", func(ctx *Context) {
+				id = ctx.RequestID()
+				ctx.SendStatus(204)
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(tt.header, tt.incoming)
+			}
+			w := serve(app, req)
+
+			if tt.want == "" {
+				if id == tt.incoming || !ValidRequestID(id) {
+					t.Errorf("RequestID() = %q, want a newly generated ID", id)
+				}
+			} else if id != tt.want {
+				t.Errorf("RequestID() = %q, want %q", id, tt.want)
+			}
+			if echoed := w.Header().Get(tt.header); echoed != id {
+				t.Errorf("%s response header = %q, want %q", tt.header, echoed, id)
+			}
+		})
+	}
+}
+
+func TestRequestIDWithoutMiddleware(t *testing.T) {
+	app := newTestApp()
+	id := "unset"
+	app.GET("/", func(ctx *Context) {
+		id = ctx.RequestID()
+	})
+
+	w := serve(app, httptest.NewRequest("GET", "/", nil))
+	if id != "" || w.Header().Get(DefaultRequestIDHeader) != "" {
+		t.Errorf("RequestID() = %q, header %q, want both empty", id, w.Header().Get(DefaultRequestIDHeader))
+	}
+}
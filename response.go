@@ -3,9 +3,9 @@ package expresso
 import (
 	"encoding/json"
 	"encoding/xml"
+	"fmt"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -17,26 +17,35 @@ import (
 // the Context to log status codes and other response details.
 type Response struct {
 	Headers  http.Header
-	w        http.ResponseWriter // The original HTTP response writer.
+	w        http.ResponseWriter // The HTTP response writer, possibly wrapped by middleware.
+	rec      *responseRecorder   // Tracks what was sent to the client, shared by copies of the Response.
 	*Context                     // The context in which the response is being generated.
 }
 
 // responseFromHttpResponseWriter creates a new Response object from an http.ResponseWriter.
 func responseFromHttpResponseWriter(w http.ResponseWriter) Response {
-	return Response{Headers: http.Header{}, w: w}
+	rec := &responseRecorder{ResponseWriter: w}
+	return Response{Headers: http.Header{}, w: rec, rec: rec}
 }
 
 // Send writes the provided data to the HTTP response. It determines the content type
 // based on the type of data and sets the appropriate headers. It supports plain text,
-// JSON, HTML, XML, and files.
+// JSON, HTML, XML, YAML, MessagePack, CBOR, templates, files and Rendered data for
+// registered renderers.
+// Unsupported types result in a 500. Templates and renderers write into a buffer first,
+// so a template error results in a 500 rather than a partially written page.
+// Send does nothing but log a warning if the response was already written.
 func (r Response) Send(data interface{}) {
 	var bs []byte
 	var err error
 
-	for k, v := range r.Headers {
-		r.w.Header().Set(k, strings.Join(v, ","))
+	if r.HeadersSent() {
+		r.rec.warn("Send called after the response was already written, the data was discarded")
+		return
 	}
 
+	r.writeHeaders()
+
 	switch data := data.(type) {
 	case Text:
 		r.w.Header().Set("Content-Type", "text/plain")
@@ -59,7 +68,11 @@ func (r Response) Send(data interface{}) {
 	case File:
 		bs, err = os.ReadFile(data.Path)
 	case Template:
-		// Handle Template rendering here (if implemented)
+		r.w.Header().Set("Content-Type", data.contentType())
+		bs, err = data.execute()
+	case *Template:
+		r.w.Header().Set("Content-Type", data.contentType())
+		bs, err = data.execute()
 	case XML:
 		r.w.Header().Set("Content-Type", "application/xml")
 		bs, err = xml.Marshal(data.Data)
@@ -72,8 +85,24 @@ func (r Response) Send(data interface{}) {
 	case *YAML:
 		r.w.Header().Set("Content-Type", "application/x-yaml")
 		bs, err = yaml.Marshal(data.Data)
+	case MsgPack:
+		r.w.Header().Set("Content-Type", MsgPackMediaType)
+		bs, err = MarshalMsgPack(data.Data)
+	case *MsgPack:
+		r.w.Header().Set("Content-Type", MsgPackMediaType)
+		bs, err = MarshalMsgPack(data.Data)
+	case CBOR:
+		r.w.Header().Set("Content-Type", CBORMediaType)
+		bs, err = MarshalCBOR(data.Data)
+	case *CBOR:
+		r.w.Header().Set("Content-Type", CBORMediaType)
+		bs, err = MarshalCBOR(data.Data)
+	case Rendered:
+		bs, err = r.render(data)
+	case *Rendered:
+		bs, err = r.render(*data)
 	default:
-		r.Context.Error("Unsupported response type")
+		err = fmt.Errorf("expresso: unsupported response type %T, see Rendered", data)
 	}
 
 	if err != nil {
@@ -85,73 +114,99 @@ func (r Response) Send(data interface{}) {
 
 	r.w.Header().Set("x-powered-by", "Expresso")
 
-	status := r.w.Header().Get("Status")
-	if status != "" {
-		code, _ := strconv.Atoi(status)
-		r.w.WriteHeader(code)
-	} else {
-		r.w.WriteHeader(http.StatusOK)
+	r.w.WriteHeader(r.rec.statusOrOK())
+
+	if _, err := r.w.Write(bs); err != nil {
+		r.Context.Error(err.Error())
+		return
 	}
+}
 
-	switch data := data.(type) {
-	case Template:
-		err = data.Tmpl.Execute(r.w, data.Data)
-		if err != nil {
-			r.SendStatus(http.StatusInternalServerError)
-		}
-	default:
-		if _, err := r.w.Write(bs); err != nil {
-			r.Context.Error(err.Error())
+// Formatted sends the option of data preferred by the client according to the Accept header of req,
+// see Context.Negotiate. Default is sent if the request has no Accept header or none of the options is
+// acceptable; with Config.StrictNegotiation the latter replies 406 Not Acceptable instead. Default also
+// wins ties with options of other media types, so "Accept: */*" gets the same response as no Accept header.
+func (r Response) Formatted(req *http.Request, data Formatted) {
+	r.formatted(req, data, r.Context != nil && r.Context.strictNegotiation)
+}
+
+// formatted implements Formatted, replying 406 Not Acceptable when no option is acceptable if strict is set.
+// Error responses are sent with strict unset, so their status is not replaced by a 406.
+func (r Response) formatted(req *http.Request, data Formatted, strict bool) {
+	if !headerContainsToken(r.Headers, "Vary", "Accept") {
+		r.Headers.Add("Vary", "Accept")
+	}
+
+	accept := req.Header.Values("Accept")
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 && data.Default != nil {
+		r.Send(data.Default)
+		return
+	}
+
+	var renderers *rendererRegistry
+	if r.Context != nil {
+		renderers = r.Context.renderers
+	}
+	offers := data.offers(renderers)
+	mediaTypes := make([]string, len(offers))
+	for i, offer := range offers {
+		mediaTypes[i] = offer.mediaType
+	}
+	if chosen := negotiate(accept, mediaTypes); chosen != "" {
+		if defaultType := mediaTypeOf(data.Default); data.Default != nil && defaultType != "" && defaultType != chosen &&
+			quality(ranges, defaultType) >= quality(ranges, chosen) {
+			r.Send(data.Default)
 			return
 		}
+		for _, offer := range offers {
+			if offer.mediaType == chosen {
+				r.Send(offer.data)
+				return
+			}
+		}
 	}
-}
 
-// Formatted sends the response based on the client's Accept header.
-func (r Response) Formatted(req *http.Request, data Formatted) {
-	accept := strings.Split(req.Header.Get("Accept"), ",")[0]
-	switch accept {
-	case "text/plain":
-		r.Send(data.Text)
-	case "text/html":
-		r.Send(data.HTML)
-	case "application/json":
-		r.Send(data.JSON)
-	case "application/xml":
-		r.Send(data.XML)
-	case "application/x-yaml", "text/yaml":
-		r.Send(data.YAML)
-	default:
+	switch {
+	case strict:
+		r.notAcceptable()
+	case data.Default != nil:
 		r.Send(data.Default)
+	case len(offers) > 0:
+		r.Send(offers[0].data)
+	default:
+		r.notAcceptable()
 	}
 }
 
-// Status sets the HTTP status code for the response and logs it.
+// Status sets the HTTP status code sent with the response, 200 by default.
+// It has no effect once the headers have been sent, see HeadersSent.
 func (r Response) Status(code int) Response {
-	r.Context.StatusCode = code
-	r.w.Header().Set("Status", strconv.Itoa(code))
+	if r.HeadersSent() {
+		r.rec.warn(fmt.Sprintf("Status(%d) called after the headers were sent with status %d", code, r.rec.status))
+	}
+	r.rec.pending = code
 	return r
 }
 
 // SendStatus writes the HTTP status code directly to the response.
 func (r Response) SendStatus(code int) {
-	r.Context.StatusCode = code
-
-	for k, v := range r.Headers {
-		r.w.Header().Set(k, strings.Join(v, ","))
-	}
+	r.writeHeaders()
 
 	r.w.WriteHeader(code)
 }
 
 // Redirect sends an HTTP redirect to the specified URL with the given status code.
 func (r Response) Redirect(url string, status int) {
-	r.Context.StatusCode = status
+	r.writeHeaders()
+
+	r.w.Header().Set("Location", url)
+	r.w.WriteHeader(status)
+}
 
+// writeHeaders copies the headers set on the Response to the underlying http.ResponseWriter.
+func (r Response) writeHeaders() {
 	for k, v := range r.Headers {
 		r.w.Header().Set(k, strings.Join(v, ","))
 	}
-
-	r.w.Header().Set("Location", url)
-	r.w.WriteHeader(status)
 }
@@ -0,0 +1,169 @@
+package expresso
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// lifecycle tracks the servers started by an App and the hooks to run when it shuts down.
+type lifecycle struct {
+	mu         sync.Mutex
+	servers    []*http.Server // Servers started by ListenAndServe and its variants.
+	onShutdown []func()       // Hooks run after the servers have been shut down.
+	closing    chan struct{}  // Closed when Shutdown starts, ending long-lived responses such as event streams.
+
+	// WebSocket connections, which http.Server no longer tracks once hijacked.
+	sockets map[*WebSocket]struct{}
+}
+
+// track registers an upgraded WebSocket so Shutdown can close it.
+func (l *lifecycle) track(ws *WebSocket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sockets == nil {
+		l.sockets = map[*WebSocket]struct{}{}
+	}
+	l.sockets[ws] = struct{}{}
+}
+
+// untrack removes a WebSocket whose handler has returned.
+func (l *lifecycle) untrack(ws *WebSocket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.sockets, ws)
+}
+
+// closeSockets sends CloseGoingAway to every open WebSocket and closes it. A client that does not
+// read gets websocketCloseTimeout to take the close message before the connection is dropped.
+func (l *lifecycle) closeSockets() {
+	l.mu.Lock()
+	sockets := make([]*WebSocket, 0, len(l.sockets))
+	for ws := range l.sockets {
+		sockets = append(sockets, ws)
+	}
+	l.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, ws := range sockets {
+		wg.Add(1)
+		go func(ws *WebSocket) {
+			defer wg.Done()
+			ws.closeWithin(CloseGoingAway, "server shutting down", websocketCloseTimeout)
+		}(ws)
+	}
+	wg.Wait()
+}
+
+// draining returns a channel that is closed when the App starts shutting down.
+func (l *lifecycle) draining() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing == nil {
+		l.closing = make(chan struct{})
+	}
+	return l.closing
+}
+
+// add tracks a server so it is drained by Shutdown.
+func (l *lifecycle) add(server *http.Server) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.servers = append(l.servers, server)
+}
+
+// OnShutdown registers a hook that runs during Shutdown, after in-flight requests have
+// been drained. Hooks run in the order they were registered.
+func (a *App) OnShutdown(hook func()) {
+	a.lifecycle.mu.Lock()
+	defer a.lifecycle.mu.Unlock()
+	a.lifecycle.onShutdown = append(a.lifecycle.onShutdown, hook)
+}
+
+// Shutdown gracefully stops every server started by the App. It stops accepting new
+// connections, ends open event streams, closes WebSocket connections with CloseGoingAway,
+// waits for in-flight requests to finish and then runs the OnShutdown hooks.
+// The wait is bounded by ctx and by Config.ShutdownTimeout, whichever expires first;
+// once exceeded, the connections still open, such as event streams and slow handlers, are
+// closed with http.Server.Close, cancelling their request contexts, and ctx's error is returned.
+func (a *App) Shutdown(ctx context.Context) error {
+	if a.Config.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.Config.ShutdownTimeout)
+		defer cancel()
+	}
+
+	a.lifecycle.mu.Lock()
+	servers := a.lifecycle.servers
+	hooks := a.lifecycle.onShutdown
+	a.lifecycle.servers = nil
+	if a.lifecycle.closing != nil {
+		close(a.lifecycle.closing)
+		a.lifecycle.closing = nil // Requests served after a restart get a fresh channel.
+	}
+	a.lifecycle.mu.Unlock()
+
+	a.lifecycle.closeSockets()
+
+	var err error
+	for _, server := range servers {
+		if e := server.Shutdown(ctx); e != nil {
+			_ = server.Close() // The grace period is over, drop the remaining connections.
+			if err == nil {
+				err = e
+			}
+		}
+	}
+
+	for _, hook := range hooks {
+		hook()
+	}
+
+	return err
+}
+
+// ListenAndServeContext starts the HTTP server on the specified address and gracefully
+// shuts it down when ctx is cancelled. It returns nil after a graceful shutdown.
+func (a *App) ListenAndServeContext(ctx context.Context, addr string) error {
+	if err := a.prepare(); err != nil {
+		return err
+	}
+	server := a.newServer(addr)
+	return a.serveContext(ctx, server.ListenAndServe)
+}
+
+// ListenAndServeTLSContext starts the HTTPS server with the given certificate and key files
+// and gracefully shuts it down when ctx is cancelled. It returns nil after a graceful shutdown.
+func (a *App) ListenAndServeTLSContext(ctx context.Context, addr, certFile, keyFile string) error {
+	if err := a.prepare(); err != nil {
+		return err
+	}
+	server := a.newServer(addr)
+	return a.serveContext(ctx, func() error {
+		return server.ListenAndServeTLS(certFile, keyFile)
+	})
+}
+
+// serveContext runs serve until it fails or ctx is cancelled, in which case the App is shut down.
+func (a *App) serveContext(ctx context.Context, serve func() error) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serve()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	// The grace period must not inherit ctx, which is already cancelled.
+	if err := a.Shutdown(context.Background()); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
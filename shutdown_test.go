@@ -0,0 +1,88 @@
+package expresso
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// startTestServer serves app on a local port until the test ends, returning the server's URL.
+func startTestServer(t *testing.T, app *App) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := app.newServer(ln.Addr().String())
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+	return "http://" + ln.Addr().String()
+}
+
+func TestShutdownClosesConnectionsAfterTimeout(t *testing.T) {
+	app := newTestApp()
+	app.Config.ShutdownTimeout = 100 * time.Millisecond
+
+	started, cancelled := make(chan struct{}), make(chan struct{})
+	app.GET("/slow", func(ctx *Context) {
+		close(started)
+		<-ctx.RawRequest.Context().Done()
+		close(cancelled)
+	})
+	url := startTestServer(t, app)
+
+	go func() {
+		if res, err := http.Get(url + "/slow"); err == nil {
+			res.Body.Close()
+		}
+	}()
+	<-started
+
+	hookRan := false
+	app.OnShutdown(func() { hookRan = true })
+	if err := app.Shutdown(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() = %v, want context.DeadlineExceeded", err)
+	}
+	if !hookRan {
+		t.Error("OnShutdown hook did not run")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("request context not cancelled after the grace period")
+	}
+}
+
+func TestShutdownWaitsForInFlightRequests(t *testing.T) {
+	app := newTestApp()
+	started := make(chan struct{})
+	app.GET("/work", func(ctx *Context) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		ctx.Send(Text{Content: "done"})
+	})
+	url := startTestServer(t, app)
+
+	result := make(chan error, 1)
+	go func() {
+		res, err := http.Get(url + "/work")
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				err = errors.New(res.Status)
+			}
+		}
+		result <- err
+	}()
+	<-started
+
+	if err := app.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("in-flight request failed: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package expresso
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSSEKeepAlive is the interval at which an EventStream sends keep-alive comments,
+// preventing proxies from closing idle connections.
+const DefaultSSEKeepAlive = 15 * time.Second
+
+// ErrStreamClosed is returned when writing to an EventStream after it was closed or the client disconnected.
+var ErrStreamClosed = errors.New("expresso: event stream closed")
+
+// EventStream is a Server-Sent Events stream to the client, created with Context.SSE.
+// Every write is flushed immediately. The stream is closed when the handler returns,
+// and Done is closed when the client disconnects or the App starts shutting down.
+type EventStream struct {
+	LastEventID string // The Last-Event-ID sent by a reconnecting client, used to resume the stream.
+
+	w        http.ResponseWriter
+	flusher  http.Flusher
+	ctx      context.Context // The request context, cancelled when the client disconnects.
+	shutdown <-chan struct{} // Closed when the App starts shutting down.
+
+	mu     sync.Mutex
+	ticker *time.Ticker
+	closed chan struct{}
+}
+
+// SSE starts a Server-Sent Events stream, writing the event-stream headers along with any set on the Response.
+// Keep-alive comments are sent every DefaultSSEKeepAlive, see EventStream.KeepAlive. The server's
+// write deadline, set from Config.WriteTimeout, is cleared so the stream can outlive it.
+// It returns an error if the underlying http.ResponseWriter does not support flushing.
+func (c *Context) SSE() (*EventStream, error) {
+	flusher, ok := c.Response.w.(http.Flusher)
+	if !ok || !canFlush(c.Response.w) {
+		return nil, errors.New("expresso: streaming is not supported by the response writer")
+	}
+
+	// Streams are open-ended; ignore writers that cannot change the deadline, such as httptest's.
+	_ = http.NewResponseController(c.Response.w).SetWriteDeadline(time.Time{})
+
+	c.Response.writeHeaders()
+	header := c.Response.w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // Disable response buffering in nginx.
+	header.Set("x-powered-by", "Expresso")
+	c.Response.w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	s := &EventStream{
+		LastEventID: c.Request.Headers.Get("Last-Event-ID"),
+		w:           c.Response.w,
+		flusher:     flusher,
+		ctx:         c.RawRequest.Context(),
+		shutdown:    c.shutdown,
+		ticker:      time.NewTicker(DefaultSSEKeepAlive),
+		closed:      make(chan struct{}),
+	}
+	c.cleanups = append(c.cleanups, s.Close)
+
+	go s.keepAlive()
+	return s, nil
+}
+
+// Done returns a channel that is closed when the client disconnects, the App starts shutting down
+// or the stream is closed.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.closed
+}
+
+// Event sends an event with the given name and id, either of which may be empty.
+// Strings and byte slices are sent as is, split over several data lines at each CRLF, CR or LF;
+// any other data is encoded as JSON.
+func (s *EventStream) Event(name, id string, data interface{}) error {
+	var payload string
+	switch data := data.(type) {
+	case string:
+		payload = data
+	case []byte:
+		payload = string(data)
+	default:
+		bs, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		payload = string(bs)
+	}
+
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", sanitizeField(id))
+	}
+	if name != "" {
+		fmt.Fprintf(&b, "event: %s\n", sanitizeField(name))
+	}
+	for _, line := range strings.Split(lineBreaks.Replace(payload), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Retry tells the client how long to wait before reconnecting after the connection is lost.
+func (s *EventStream) Retry(d time.Duration) error {
+	return s.write(fmt.Sprintf("retry: %d\n\n", d.Milliseconds()))
+}
+
+// Comment sends a comment line, which clients ignore.
+func (s *EventStream) Comment(text string) error {
+	return s.write(": " + sanitizeField(text) + "\n\n")
+}
+
+// KeepAlive changes the interval at which keep-alive comments are sent. A zero interval disables them.
+func (s *EventStream) KeepAlive(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if interval <= 0 {
+		s.ticker.Stop()
+		return
+	}
+	s.ticker.Reset(interval)
+}
+
+// Close stops the stream. It is called automatically when the handler returns.
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.closed:
+	default:
+		s.ticker.Stop()
+		close(s.closed)
+	}
+}
+
+// keepAlive sends a comment at every tick until the stream is closed, the client disconnects
+// or the App shuts down.
+func (s *EventStream) keepAlive() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			s.Close()
+			return
+		case <-s.shutdown:
+			s.Close()
+			return
+		case <-s.closed:
+			return
+		case <-s.ticker.C:
+			_ = s.Comment("keep-alive")
+		}
+	}
+}
+
+// write sends raw event-stream text to the client and flushes it.
+func (s *EventStream) write(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.closed:
+		return ErrStreamClosed
+	case <-s.ctx.Done():
+		return ErrStreamClosed
+	default:
+	}
+
+	if _, err := s.w.Write([]byte(text)); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// lineBreaks normalizes the line endings recognized by event-stream parsers to LF.
+var lineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// sanitizeField removes line breaks, which would otherwise end an event-stream field early.
+func sanitizeField(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
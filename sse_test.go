@@ -0,0 +1,104 @@
+package expresso
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSEEvents(t *testing.T) {
+	app := newTestApp()
+	app.GET("/events", func(ctx *Context) {
+		stream, err := ctx.SSE()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		stream.Retry(time.Second)
+		stream.Event("greeting", "1", "hello\nworld")
+		stream.Event("", "", map[string]int{"n": 2})
+		stream.Comment("note\r\nline")
+		stream.Event("", "", "hello\revent: admin\rdata: pwned\r\nend")
+	})
+
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	w := serve(app, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	want := "retry: 1000\n\n" +
+		"id: 1\nevent: greeting\ndata: hello\ndata: world\n\n" +
+		"data: {\"n\":2}\n\n" +
+		": noteline\n\n" +
+		"data: hello\ndata: event: admin\ndata: data: pwned\ndata: end\n\n" // A lone CR cannot start a new field.
+	if got := w.Body.String(); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestSSEOutlivesWriteTimeout(t *testing.T) {
+	app := newTestApp()
+	app.Config.WriteTimeout = 100 * time.Millisecond
+	app.GET("/events", func(ctx *Context) {
+		stream, err := ctx.SSE()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		time.Sleep(300 * time.Millisecond) // Past the write deadline set by the server.
+		stream.Event("late", "", "still open")
+	})
+	url := startTestServer(t, app)
+
+	res, err := http.Get(url + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	scanner := bufio.NewScanner(res.Body)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if got := strings.Join(lines, "\n"); !strings.Contains(got, "data: still open") {
+		t.Fatalf("stream = %q (%v), want the event sent after the write timeout", got, scanner.Err())
+	}
+}
+
+func TestSSEEndsOnShutdown(t *testing.T) {
+	app := newTestApp()
+	app.Config.ShutdownTimeout = 5 * time.Second
+	started := make(chan struct{})
+	app.GET("/events", func(ctx *Context) {
+		stream, err := ctx.SSE()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		close(started)
+		<-stream.Done()
+	})
+	url := startTestServer(t, app)
+
+	res, err := http.Get(url + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	<-started
+
+	start := time.Now()
+	if err := app.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Shutdown took %s, want the stream to end without waiting for the timeout", elapsed)
+	}
+}
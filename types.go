@@ -30,6 +30,18 @@ type YAML struct {
 	Data interface{} // The data to be marshaled into YAML for the response.
 }
 
+// MsgPack represents MessagePack content for an HTTP response.
+// Structs are encoded with the field names of their "json" tags, see MarshalMsgPack.
+type MsgPack struct {
+	Data interface{} // The data to be encoded as MessagePack for the response.
+}
+
+// CBOR represents CBOR content for an HTTP response.
+// Structs are encoded with the field names of their "json" tags, see MarshalCBOR.
+type CBOR struct {
+	Data interface{} // The data to be encoded as CBOR for the response.
+}
+
 // File represents a file to be sent as an HTTP response.
 type File struct {
 	Path        string // The file path to be read and sent in the response.
@@ -46,10 +58,13 @@ type Template struct {
 // Formatted represents different formats for an HTTP response.
 // The appropriate format is selected based on the client's Accept header.
 type Formatted struct {
-	Text    *Text       // The plain text content option.
-	HTML    *HTML       // The HTML content option.
-	JSON    *JSON       // The JSON content option.
-	XML     *XML        // The XML content option.
-	YAML    *YAML       // The YAML content option.
-	Default interface{} // The default content if no Accept header matches.
+	Text    *Text                  // The plain text content option.
+	HTML    *HTML                  // The HTML content option.
+	JSON    *JSON                  // The JSON content option.
+	XML     *XML                   // The XML content option.
+	YAML    *YAML                  // The YAML content option.
+	MsgPack *MsgPack               // The MessagePack content option.
+	CBOR    *CBOR                  // The CBOR content option.
+	Custom  map[string]interface{} // Data for media types with a Renderer, keyed by media type, see App.RegisterRenderer.
+	Default interface{}            // The default content if no Accept header matches.
 }
@@ -0,0 +1,329 @@
+package expresso
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// UploadOptions limits the multipart uploads accepted by FormFile, FormFiles and EachPart.
+// The App-wide defaults are set with Config.Uploads and can be overridden per route with UploadLimits.
+type UploadOptions struct {
+	// MaxFileSize is the maximum size of a single file in bytes. Zero means no limit.
+	MaxFileSize int64
+	// MaxTotalSize is the maximum size of the whole multipart body in bytes, in addition to
+	// Config.MaxBodyBytes. Zero means no limit.
+	MaxTotalSize int64
+	// MaxMemory is the number of bytes of a parsed form kept in memory, the remainder being stored
+	// in temporary files removed at the end of the request. Defaults to 32 MB.
+	MaxMemory int64
+	// AllowedTypes lists the media types accepted for files, either exact, such as "application/pdf",
+	// or a type wildcard, such as "image/*". Types are sniffed from the content rather than trusted from
+	// the client, see http.DetectContentType. If empty, any type is accepted.
+	AllowedTypes []string
+}
+
+// UploadLimits returns a middleware overriding Config.Uploads for the routes it is applied to.
+func UploadLimits(opts UploadOptions) Middleware {
+	return func(ctx *Context) {
+		ctx.uploads = opts
+		ctx.Next()
+	}
+}
+
+// UploadedFile is a file received in a multipart form, see Context.FormFile.
+type UploadedFile struct {
+	*multipart.FileHeader        // The file name, headers and size sent by the client.
+	ContentType           string // The media type sniffed from the file's content.
+}
+
+// UploadPart is a part of a multipart body being streamed by Context.EachPart. Reading it
+// returns the part's content, failing with a 413 HTTPError once it exceeds UploadOptions.MaxFileSize.
+type UploadPart struct {
+	io.Reader
+	FormName    string               // The name of the form field.
+	FileName    string               // The file name sent by the client, empty for plain form fields.
+	ContentType string               // For files, the media type sniffed from the content; otherwise the declared type.
+	Header      textproto.MIMEHeader // The part's headers.
+}
+
+// FormFile returns the first file uploaded in the multipart form field name. The form is parsed on
+// first use, holding up to UploadOptions.MaxMemory bytes in memory and the rest in temporary files,
+// which are removed when the request ends. It returns a 400 HTTPError if there is no such file, a 413
+// if the file or body exceeds the configured limits and a 415 if the body is not a multipart form or
+// the file's type is not allowed.
+func (c *Context) FormFile(name string) (*UploadedFile, error) {
+	files, err := c.FormFiles(name)
+	if err != nil {
+		return nil, err
+	}
+	return files[0], nil
+}
+
+// FormFiles returns every file uploaded in the multipart form field name, see FormFile.
+func (c *Context) FormFiles(name string) ([]*UploadedFile, error) {
+	if err := c.parseMultipart(); err != nil {
+		return nil, uploadError(err)
+	}
+
+	headers := c.RawRequest.MultipartForm.File[name]
+	if len(headers) == 0 {
+		return nil, NewHTTPError(http.StatusBadRequest, fmt.Sprintf("missing file %q", name), nil)
+	}
+
+	files := make([]*UploadedFile, 0, len(headers))
+	for _, header := range headers {
+		contentType, err := sniffFile(header)
+		if err != nil {
+			return nil, err
+		}
+		if !typeAllowed(contentType, c.uploads.AllowedTypes) {
+			return nil, typeNotAllowed(header.Filename, contentType)
+		}
+		files = append(files, &UploadedFile{FileHeader: header, ContentType: contentType})
+	}
+	return files, nil
+}
+
+// SaveUploadedFile writes the content of file to dst, creating its directory if needed. The file name
+// sent by the client must not be trusted as a path; use filepath.Base or generate a name instead.
+func (c *Context) SaveUploadedFile(file *UploadedFile, dst string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// EachPart streams the parts of a multipart body to fn in order, without buffering them in memory or
+// on disk, for uploads too large to parse with FormFile. Limits and allowed types are enforced as the
+// parts are read; fn must consume a part before returning, as the next part starts where it ends.
+// Errors returned by fn stop the iteration and are returned as is. EachPart cannot be combined with
+// FormFile, FormFiles or Bind on the same request, as each consumes the body.
+func (c *Context) EachPart(fn func(part *UploadPart) error) error {
+	mediaType, params, err := mime.ParseMediaType(c.Request.Headers.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return uploadError(http.ErrNotMultipart)
+	}
+
+	c.limitUpload()
+	reader := multipart.NewReader(c.BodyReader(), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return uploadError(err)
+		}
+
+		up := &UploadPart{
+			Reader:      part,
+			FormName:    part.FormName(),
+			FileName:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Header:      part.Header,
+		}
+		if up.FileName != "" {
+			if c.uploads.MaxFileSize > 0 {
+				up.Reader = &limitedReader{r: part, remaining: c.uploads.MaxFileSize, err: fileTooLarge(up.FileName, c.uploads.MaxFileSize)}
+			}
+			br := bufio.NewReaderSize(up.Reader, sniffLen)
+			head, err := br.Peek(sniffLen)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return uploadError(err)
+			}
+			up.Reader = br
+			up.ContentType = http.DetectContentType(head)
+			if !typeAllowed(up.ContentType, c.uploads.AllowedTypes) {
+				return typeNotAllowed(up.FileName, up.ContentType)
+			}
+		}
+
+		if err := fn(up); err != nil {
+			return err
+		}
+		part.Close()
+	}
+}
+
+// parseMultipart parses the multipart form once, applying the upload limits, and registers the removal
+// of its temporary files at the end of the request. Files larger than UploadOptions.MaxFileSize are
+// rejected as they are read, before being stored.
+func (c *Context) parseMultipart() error {
+	if c.RawRequest.MultipartForm != nil {
+		return nil
+	}
+	c.limitUpload()
+	if c.uploads.MaxFileSize > 0 {
+		c.limitFileParts()
+	}
+
+	maxMemory := c.uploads.MaxMemory
+	if maxMemory <= 0 {
+		maxMemory = defaultMultipartMemory
+	}
+	err := c.RawRequest.ParseMultipartForm(maxMemory)
+	if form := c.RawRequest.MultipartForm; form != nil {
+		c.cleanups = append(c.cleanups, func() {
+			_ = form.RemoveAll()
+		})
+	}
+	return err
+}
+
+// limitUpload caps the request body at UploadOptions.MaxTotalSize.
+func (c *Context) limitUpload() {
+	if c.uploads.MaxTotalSize > 0 && !c.Request.bodyConsumed && c.Request.Body == nil {
+		// MaxBytesReader closes the connection through the server's own ResponseWriter, not its wrappers.
+		c.RawRequest.Body = http.MaxBytesReader(c.Response.rec.ResponseWriter, c.RawRequest.Body, c.uploads.MaxTotalSize)
+	}
+}
+
+// limitFileParts makes the request body fail with a 413 HTTPError as soon as a file in the multipart
+// form exceeds UploadOptions.MaxFileSize. ParseMultipartForm offers no per-file limit, so the parts are
+// copied through a pipe, each file being read with a limitedReader as in EachPart.
+func (c *Context) limitFileParts() {
+	_, params, err := mime.ParseMediaType(c.Request.Headers.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" || c.RawRequest.Body == nil {
+		return // ParseMultipartForm reports the malformed request.
+	}
+
+	pr, pw := io.Pipe()
+	body, limit := c.RawRequest.Body, c.uploads.MaxFileSize
+	go func() {
+		pw.CloseWithError(copyParts(pw, multipart.NewReader(body, params["boundary"]), params["boundary"], limit))
+	}()
+	c.RawRequest.Body = pr
+	c.cleanups = append(c.cleanups, func() {
+		_ = pr.Close() // Stops the copy if the form was not read to the end.
+	})
+}
+
+// copyParts copies the raw parts of a multipart body to w, failing once a file exceeds limit bytes.
+func copyParts(w io.Writer, reader *multipart.Reader, boundary string, limit int64) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+	for {
+		part, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			return mw.Close()
+		}
+		if err != nil {
+			return err
+		}
+
+		dst, err := mw.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+		var src io.Reader = part
+		if name := part.FileName(); name != "" {
+			src = &limitedReader{r: part, remaining: limit, err: fileTooLarge(name, limit)}
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			return err
+		}
+	}
+}
+
+// sniffFile detects the media type of an uploaded file from its first bytes.
+func sniffFile(header *multipart.FileHeader) (string, error) {
+	f, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// typeAllowed reports whether the media type of contentType matches one of the allowed types.
+// Any type is allowed if the list is empty.
+func typeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if a == mediaType || strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, a[:len(a)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadError converts an error from reading a multipart body into an HTTPError.
+func uploadError(err error) error {
+	if errors.Is(err, http.ErrNotMultipart) || errors.Is(err, http.ErrMissingBoundary) {
+		return NewHTTPError(http.StatusUnsupportedMediaType, "expected a multipart/form-data body", err)
+	}
+	return BodyError(err)
+}
+
+// fileTooLarge returns the 413 HTTPError for a file exceeding UploadOptions.MaxFileSize.
+func fileTooLarge(name string, limit int64) error {
+	return NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("file %q larger than %d bytes", name, limit), nil)
+}
+
+// typeNotAllowed returns the 415 HTTPError for a file whose type is not in UploadOptions.AllowedTypes.
+func typeNotAllowed(name, contentType string) error {
+	return NewHTTPError(http.StatusUnsupportedMediaType, fmt.Sprintf("file %q has disallowed type %s", name, contentType), nil)
+}
+
+// limitedReader reads from r, failing with err once more than remaining bytes are read.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+// Read reads from the underlying reader, returning l.err instead of data past the limit.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, l.err
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1] // Read one byte past the limit to detect oversized input.
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), l.err
+	}
+	return n, err
+}
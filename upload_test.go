@@ -0,0 +1,145 @@
+package expresso
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// multipartBody encodes a form with a title field and a file, leaving the writer open so more parts can be added.
+func multipartBody(t *testing.T, fileName string, content []byte) (*bytes.Buffer, *multipart.Writer) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.WriteField("title", "report"); err != nil {
+		t.Fatal(err)
+	}
+	fw, err := mw.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	return &buf, mw
+}
+
+// newUploadApp returns an App with the given limits, replying with the title field and the uploaded file's size.
+func newUploadApp(opts UploadOptions) *App {
+	app := newTestApp()
+	app.Config.Uploads = opts
+	app.POST("/", func(ctx *Context) {
+		var form struct {
+			Title string `form:"title"`
+		}
+		file, err := ctx.FormFile("file")
+		if err == nil {
+			err = ctx.Bind(&form)
+		}
+		if err != nil {
+			ctx.Fail(err)
+			return
+		}
+		ctx.Send(Text{Content: form.Title + " " + strconv.FormatInt(file.Size, 10)})
+	})
+	return app
+}
+
+func TestFormFileSize(t *testing.T) {
+	app := newUploadApp(UploadOptions{MaxFileSize: 1024})
+	tests := []struct {
+		size int
+		code int
+		body string
+	}{
+		{1024, http.StatusOK, "report 1024"},
+		{1025, http.StatusRequestEntityTooLarge, ""},
+	}
+	for _, tt := range tests {
+		body, mw := multipartBody(t, "data.bin", bytes.Repeat([]byte("a"), tt.size))
+		mw.Close()
+		req := httptest.NewRequest("POST", "/", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := serve(app, req)
+		if w.Code != tt.code || tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("file of %d bytes: response = %d %q, want %d %q", tt.size, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
+
+// failingReader fails every read, standing in for the part of a body that must not be read.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read past the oversized file")
+}
+
+func TestFormFileSizeEnforcedWhileParsing(t *testing.T) {
+	const limit = 1024
+	// The oversized file is followed by a body that fails to read: the upload must be rejected as soon as
+	// the file crosses the limit, not once the whole form has been parsed.
+	body, mw := multipartBody(t, "data.bin", bytes.Repeat([]byte("a"), limit+64<<10))
+	req := httptest.NewRequest("POST", "/", io.MultiReader(body, failingReader{}))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	w := serve(newUploadApp(UploadOptions{MaxFileSize: limit}), req)
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "larger than 1024 bytes") {
+		t.Errorf("response = %d %q, want 413 for the file", w.Code, w.Body.String())
+	}
+}
+
+func TestEachPartFileSize(t *testing.T) {
+	body, mw := multipartBody(t, "data.bin", bytes.Repeat([]byte("a"), 2048))
+	mw.Close()
+
+	app := newTestApp()
+	app.Config.Uploads = UploadOptions{MaxFileSize: 1024}
+	app.POST("/", func(ctx *Context) {
+		err := ctx.EachPart(func(part *UploadPart) error {
+			_, err := io.Copy(io.Discard, part)
+			return err
+		})
+		if err != nil {
+			ctx.Fail(err)
+			return
+		}
+		ctx.SendStatus(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if w := serve(app, req); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", w.Code)
+	}
+}
+
+func TestUploadTotalSizeClosesConnection(t *testing.T) {
+	app := newUploadApp(UploadOptions{MaxTotalSize: 1024})
+	app.Use(NewCompressMiddleware(CompressOptions{}))
+	url := startTestServer(t, app)
+
+	body, mw := multipartBody(t, "data.bin", bytes.Repeat([]byte("a"), 4096))
+	mw.Close()
+	req, _ := http.NewRequest("POST", url+"/", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", resp.StatusCode)
+	}
+	// The server only closes the connection, rather than draining the rest of the body, when
+	// MaxBytesReader is given its own ResponseWriter.
+	if !resp.Close {
+		t.Error("connection kept open after the body limit was hit")
+	}
+}
@@ -0,0 +1,299 @@
+package expresso
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes a single struct field that failed validation.
+type FieldError struct {
+	Field   string `json:"field" xml:"field" yaml:"field"`                               // The name of the field, as it appears in JSON.
+	Rule    string `json:"rule" xml:"rule" yaml:"rule"`                                  // The rule that failed, e.g. "required" or "min".
+	Param   string `json:"param,omitempty" xml:"param,omitempty" yaml:"param,omitempty"` // The rule parameter, e.g. "3" for "min=3".
+	Message string `json:"message" xml:"message" yaml:"message"`                         // A description of the failure.
+}
+
+// ValidationError lists every field that failed validation. The DefaultErrorHandler renders it
+// as a 422 Unprocessable Entity response listing each failing field.
+type ValidationError struct {
+	Errors []FieldError // The failing fields, in struct order.
+}
+
+// Error joins the messages of every failing field.
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		messages[i] = fe.Field + " " + fe.Message
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// Validate checks the struct pointed to by v against the rules in its "validate" tags and returns
+// a *ValidationError listing every failing field, or nil. It is run automatically by Bind and its variants.
+// Nested structs are validated recursively, including those held in slices, arrays and maps, whose
+// fields are reported with an index or key, e.g. "items[2].name". Supported rules, separated by commas:
+//   - required: the field must not be the zero value.
+//   - min=n, max=n: bounds on the value of numbers, the length of strings, or the size of slices and maps.
+//   - len=n: the exact length of strings, or size of slices and maps.
+//   - email: the string must be a valid email address.
+//   - oneof=a b c: the value must be one of the space separated options.
+//
+// Rules other than required are skipped for nil pointers and empty strings.
+func Validate(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs []FieldError
+	if err := validateStruct(rv, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// validateStruct validates the fields of rv, appending failures to errs. Field names are prefixed with prefix.
+func validateStruct(rv reflect.Value, prefix string, errs *[]FieldError) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fv := rv.Field(i)
+		name := prefix + fieldName(field)
+		if field.Anonymous {
+			name = strings.TrimSuffix(prefix, ".")
+		}
+
+		if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+			if err := validateField(fv, name, tag, errs); err != nil {
+				return fmt.Errorf("expresso: field %s: %w", field.Name, err)
+			}
+		}
+
+		if err := validateNested(fv, name, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateNested validates the structs held by fv: a nested struct, or the structs in a slice, array or
+// map, which are reported with an index or key, e.g. "items[2].name" or "prices[EUR].amount".
+// Types such as time.Time, which encode as text, are not descended into.
+func validateNested(fv reflect.Value, name string, errs *[]FieldError) error {
+	for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+
+	switch fv.Kind() {
+	case reflect.Struct:
+		if reflect.PointerTo(fv.Type()).Implements(textUnmarshalerType) {
+			return nil
+		}
+		prefix := name + "."
+		if name == "" {
+			prefix = ""
+		}
+		return validateStruct(fv, prefix, errs)
+	case reflect.Slice, reflect.Array:
+		if !holdsStructs(fv.Type().Elem()) {
+			return nil
+		}
+		for i := 0; i < fv.Len(); i++ {
+			if err := validateNested(fv.Index(i), name+"["+strconv.Itoa(i)+"]", errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if !holdsStructs(fv.Type().Elem()) {
+			return nil
+		}
+		keys := fv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			if err := validateNested(fv.MapIndex(key), name+"["+fmt.Sprint(key.Interface())+"]", errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// holdsStructs reports whether values of type t may contain structs to validate.
+func holdsStructs(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct || t.Kind() == reflect.Interface
+}
+
+// fieldName returns the name a field is reported under: its JSON name if it has one, else its Go name.
+func fieldName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+// validateField applies each rule in tag to fv, appending the first failure to errs.
+func validateField(fv reflect.Value, name, tag string, errs *[]FieldError) error {
+	for _, rule := range strings.Split(tag, ",") {
+		rule, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		if rule == "required" {
+			if fv.IsZero() {
+				*errs = append(*errs, FieldError{Field: name, Rule: rule, Message: "is required"})
+				return nil
+			}
+			continue
+		}
+
+		value := fv
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				return nil
+			}
+			value = value.Elem()
+		}
+		if value.Kind() == reflect.String && value.Len() == 0 {
+			return nil
+		}
+
+		message, err := checkRule(value, rule, param)
+		if err != nil {
+			return err
+		}
+		if message != "" {
+			*errs = append(*errs, FieldError{Field: name, Rule: rule, Param: param, Message: message})
+			return nil
+		}
+	}
+	return nil
+}
+
+// checkRule returns a failure message if value does not satisfy rule, or an error if the rule is invalid.
+func checkRule(value reflect.Value, rule, param string) (string, error) {
+	switch rule {
+	case "min", "max", "len":
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s parameter %q", rule, param)
+		}
+		size, unit, ok := measure(value)
+		if !ok {
+			return "", fmt.Errorf("rule %s is not supported for type %s", rule, value.Type())
+		}
+		switch {
+		case rule == "min" && size < n:
+			return fmt.Sprintf("must be at least %s%s", param, unit), nil
+		case rule == "max" && size > n:
+			return fmt.Sprintf("must be at most %s%s", param, unit), nil
+		case rule == "len" && size != n:
+			return fmt.Sprintf("must be exactly %s%s", param, unit), nil
+		}
+	case "email":
+		if value.Kind() != reflect.String {
+			return "", fmt.Errorf("rule email is not supported for type %s", value.Type())
+		}
+		if addr, err := mail.ParseAddress(value.String()); err != nil || addr.Address != value.String() {
+			return "must be a valid email address", nil
+		}
+	case "oneof":
+		actual := fmt.Sprint(value.Interface())
+		for _, option := range strings.Fields(param) {
+			if actual == option {
+				return "", nil
+			}
+		}
+		return "must be one of: " + strings.Join(strings.Fields(param), ", "), nil
+	default:
+		return "", fmt.Errorf("unknown validation rule %q", rule)
+	}
+	return "", nil
+}
+
+// measure returns the quantity compared by min, max and len: the value of numbers, the number of
+// characters in strings and the number of items in slices, arrays and maps, along with its unit.
+func measure(value reflect.Value) (float64, string, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), " characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), " items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), "", true
+	}
+	return 0, "", false
+}
+
+// validationFormatted builds the 422 response body listing each failing field in every supported format.
+func validationFormatted(err *ValidationError) Formatted {
+	const message = "validation failed"
+	code := http.StatusUnprocessableEntity
+
+	title := fmt.Sprintf("%d - %s", code, message)
+	text := title
+	items := ""
+	for _, fe := range err.Errors {
+		line := fe.Field + ": " + fe.Message
+		text += "\n" + line
+		items += "<li>" + html.EscapeString(line) + "</li>"
+	}
+
+	data := map[string]interface{}{
+		"status": code,
+		"error":  message,
+		"fields": err.Errors,
+	}
+
+	return Formatted{
+		Text: &Text{text},
+		HTML: &HTML{"<html><head><title>" + title + "</title></head><body>" + title + "<ul>" + items + "</ul></body></html>"},
+		JSON: &JSON{Data: data},
+		XML: &XML{
+			Data: struct {
+				XMLName xml.Name     `xml:"error"`
+				Status  int          `xml:"status"`
+				Error   string       `xml:"error"`
+				Fields  []FieldError `xml:"fields>field"`
+			}{
+				Status: code,
+				Error:  message,
+				Fields: err.Errors,
+			},
+		},
+		YAML:    &YAML{Data: data},
+		MsgPack: &MsgPack{Data: data},
+		CBOR:    &CBOR{Data: data},
+		Default: &JSON{Data: data},
+	}
+}
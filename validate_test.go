@@ -0,0 +1,124 @@
+package expresso
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type validateItem struct {
+	Name  string `json:"name" validate:"required"`
+	Price int    `json:"price" validate:"min=1"`
+}
+
+type validateOrder struct {
+	Email    string                  `json:"email" validate:"required,email"`
+	Status   string                  `json:"status" validate:"oneof=open closed"`
+	Note     string                  `json:"note" validate:"max=5"`
+	Count    *int                    `json:"count" validate:"min=1"`
+	Tags     []string                `json:"tags" validate:"len=2"`
+	Address  validateItem            `json:"address"`
+	Items    []validateItem          `json:"items" validate:"min=1"`
+	Pointers []*validateItem         `json:"pointers"`
+	Fixed    [2]validateItem         `json:"fixed"`
+	Prices   map[string]validateItem `json:"prices"`
+	Created  time.Time               `json:"created"`
+}
+
+func validOrder() validateOrder {
+	item := validateItem{Name: "pen", Price: 2}
+	return validateOrder{
+		Email:    "a@example.com",
+		Status:   "open",
+		Tags:     []string{"a", "b"},
+		Address:  item,
+		Items:    []validateItem{item},
+		Pointers: []*validateItem{&item, nil},
+		Fixed:    [2]validateItem{item, item},
+		Prices:   map[string]validateItem{"EUR": item},
+	}
+}
+
+// failingFields returns the fields reported by Validate(v), failing the test on other errors.
+func failingFields(t *testing.T, v interface{}) []string {
+	t.Helper()
+	err := Validate(v)
+	if err == nil {
+		return nil
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Validate() = %v, want *ValidationError", err)
+	}
+	fields := make([]string, len(verr.Errors))
+	for i, fe := range verr.Errors {
+		fields[i] = fe.Field + ":" + fe.Rule
+	}
+	return fields
+}
+
+func TestValidateValid(t *testing.T) {
+	order := validOrder()
+	if fields := failingFields(t, &order); fields != nil {
+		t.Fatalf("valid order failed: %v", fields)
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	zero := 0
+	order := validOrder()
+	order.Email = "not-an-email"
+	order.Status = "pending"
+	order.Note = "too long"
+	order.Count = &zero
+	order.Tags = []string{"a"}
+
+	want := []string{"email:email", "status:oneof", "note:max", "count:min", "tags:len"}
+	if got := failingFields(t, &order); !reflect.DeepEqual(got, want) {
+		t.Fatalf("failing fields = %v, want %v", got, want)
+	}
+}
+
+func TestValidateRequired(t *testing.T) {
+	order := validOrder()
+	order.Email = ""
+	order.Items = nil
+
+	want := []string{"email:required", "items:min"}
+	if got := failingFields(t, &order); !reflect.DeepEqual(got, want) {
+		t.Fatalf("failing fields = %v, want %v", got, want)
+	}
+}
+
+func TestValidateNestedCollections(t *testing.T) {
+	order := validOrder()
+	order.Address.Name = ""
+	order.Items = append(order.Items, validateItem{Name: "cup"}, validateItem{Price: 3})
+	order.Pointers[0] = &validateItem{Price: 1}
+	order.Fixed[1].Price = -1
+	order.Prices["USD"] = validateItem{Price: 1}
+
+	want := []string{
+		"address.name:required",
+		"items[1].price:min",
+		"items[2].name:required",
+		"pointers[0].name:required",
+		"fixed[1].price:min",
+		"prices[USD].name:required",
+	}
+	if got := failingFields(t, &order); !reflect.DeepEqual(got, want) {
+		t.Fatalf("failing fields = %v, want %v", got, want)
+	}
+}
+
+func TestValidateInvalidRule(t *testing.T) {
+	v := struct {
+		Name string `validate:"bogus"`
+	}{Name: "x"}
+	err := Validate(&v)
+	var verr *ValidationError
+	if err == nil || errors.As(err, &verr) {
+		t.Fatalf("Validate() = %v, want a configuration error", err)
+	}
+}
@@ -0,0 +1,295 @@
+package expresso
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// contentTemplate is the name a view is parsed under, so layouts can include it with {{ template "content" . }}.
+const contentTemplate = "content"
+
+// ViewEngine loads html/template views from a directory and renders them with layouts and partials.
+//
+// Templates are named by their path relative to the directory, without the extension and with
+// forward slashes, e.g. "users/index" for "views/users/index.html". Files under "layouts/" are
+// layouts and files under "partials/" are partials; every other file is a view.
+//
+//   - A view is parsed as the "content" template and may define further blocks, e.g. {{ define "title" }}.
+//   - A layout wraps views. It includes the view with {{ template "content" . }} and may declare
+//     blocks with defaults, e.g. {{ block "title" . }}Default{{ end }}. Every view can be rendered with
+//     every layout: the default layout is "layouts/main" when it exists, see Layout, and another can be
+//     chosen per render with Context.RenderLayout.
+//   - Partials are available to layouts and views by name, e.g. {{ template "partials/header" . }}.
+type ViewEngine struct {
+	fsys   fs.FS            // The file system the templates are loaded from.
+	source string           // A description of the template source for error messages, e.g. the directory.
+	ext    string           // The extension of template files, e.g. ".html".
+	funcs  template.FuncMap // Custom functions available to every template.
+	layout *string          // The default layout wrapping views, nil for "layouts/main" if it exists.
+	reload func() bool      // Reports whether changed templates should be re-parsed before rendering.
+
+	mu            sync.Mutex
+	views         map[string]map[string]*template.Template // Parsed views keyed by name, then by layout ("" for none); nil until loaded.
+	defaultLayout string                                   // The default layout of the loaded views, "" for none.
+	stamp         string                                   // The names, sizes and modification times of the loaded files.
+}
+
+// Views configures the App's view engine to load templates with the given extension from dir.
+// The templates are parsed when the server starts, so syntax errors make ListenAndServe fail,
+// or on first render when the App is used directly as an http.Handler.
+// In development mode, see Config.Development, templates changed on disk are re-parsed before rendering.
+func (a *App) Views(dir, ext string) *ViewEngine {
+	a.ViewsFS(os.DirFS(dir), ext)
+	a.views.source = dir
+	return a.views
+}
+
+// ViewsFS is like Views but loads the templates from a file system, such as an embed.FS.
+func (a *App) ViewsFS(fsys fs.FS, ext string) *ViewEngine {
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	a.views = &ViewEngine{
+		fsys:   fsys,
+		source: "the view file system",
+		ext:    ext,
+		funcs:  template.FuncMap{},
+		reload: func() bool {
+			return a.Config.Development
+		},
+	}
+	return a.views
+}
+
+// Funcs adds custom functions available to every template. It must be called before the templates are loaded.
+func (v *ViewEngine) Funcs(funcs template.FuncMap) *ViewEngine {
+	for name, fn := range funcs {
+		v.funcs[name] = fn
+	}
+	return v
+}
+
+// Layout sets the default layout wrapping views, e.g. "layouts/admin". An empty name renders views
+// without a layout by default.
+func (v *ViewEngine) Layout(name string) *ViewEngine {
+	v.layout = &name
+	return v
+}
+
+// Load parses every template in the directory, including every layout, returning the first error encountered.
+func (v *ViewEngine) Load() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.load()
+}
+
+// Lookup returns the parsed view with the given name, ready to be executed with the default layout.
+func (v *ViewEngine) Lookup(name string) (*template.Template, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return v.lookup(name, v.defaultLayout)
+}
+
+// LookupLayout returns the parsed view with the given name, ready to be executed with the given
+// layout, e.g. "layouts/admin". An empty layout returns the view alone.
+func (v *ViewEngine) LookupLayout(name, layout string) (*template.Template, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return v.lookup(name, layout)
+}
+
+// ensureLoaded parses the templates on first use, and again in development mode if they changed.
+func (v *ViewEngine) ensureLoaded() error {
+	if v.views == nil || v.reload() && v.changed() {
+		return v.load()
+	}
+	return nil
+}
+
+// lookup returns the loaded view with the given name and layout.
+func (v *ViewEngine) lookup(name, layout string) (*template.Template, error) {
+	layouts, ok := v.views[name]
+	if !ok {
+		return nil, fmt.Errorf("expresso: view %q not found in %s", name, v.source)
+	}
+	tmpl, ok := layouts[layout]
+	if !ok {
+		return nil, fmt.Errorf("expresso: layout %q not found in %s", layout, v.source)
+	}
+	return tmpl, nil
+}
+
+// load parses the templates in the directory, replacing the views only if every template parses.
+// Each view is parsed once without a layout and once with each layout, so that every layout keeps
+// its own block defaults.
+func (v *ViewEngine) load() error {
+	sources := map[string]string{}
+	stamp, err := v.walk(func(name, file string) error {
+		bs, err := fs.ReadFile(v.fsys, file)
+		if err != nil {
+			return err
+		}
+		sources[name] = string(bs)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("expresso: loading views: %w", err)
+	}
+
+	defaultLayout := "layouts/main"
+	if v.layout != nil {
+		defaultLayout = *v.layout
+	} else if _, ok := sources[defaultLayout]; !ok {
+		defaultLayout = ""
+	}
+	if defaultLayout != "" {
+		if _, ok := sources[defaultLayout]; !ok {
+			return fmt.Errorf("expresso: layout %q not found in %s", defaultLayout, v.source)
+		}
+	}
+
+	base := template.New("").Funcs(v.funcs)
+	for name, src := range sources {
+		if strings.HasPrefix(name, "partials/") {
+			if _, err := base.New(name).Parse(src); err != nil {
+				return fmt.Errorf("expresso: parsing partial: %w", err)
+			}
+		}
+	}
+
+	// Every layout is parsed up front, so its syntax errors are reported even if no view uses it.
+	layouts := map[string]*template.Template{"": base}
+	for name, src := range sources {
+		if !strings.HasPrefix(name, "layouts/") {
+			continue
+		}
+		tmpl, err := base.Clone()
+		if err != nil {
+			return err
+		}
+		if _, err := tmpl.New(name).Parse(src); err != nil {
+			return fmt.Errorf("expresso: parsing layout: %w", err)
+		}
+		layouts[name] = tmpl
+	}
+
+	views := map[string]map[string]*template.Template{}
+	for name, src := range sources {
+		if strings.HasPrefix(name, "partials/") || strings.HasPrefix(name, "layouts/") {
+			continue
+		}
+
+		views[name] = map[string]*template.Template{}
+		for layout, layoutBase := range layouts {
+			tmpl, err := layoutBase.Clone()
+			if err != nil {
+				return err
+			}
+			if _, err := tmpl.New(contentTemplate).Parse(src); err != nil {
+				return fmt.Errorf("expresso: parsing view %q: %w", name, err)
+			}
+
+			entry := contentTemplate
+			if layout != "" {
+				entry = layout
+			}
+			views[name][layout] = tmpl.Lookup(entry)
+		}
+	}
+
+	v.views = views
+	v.defaultLayout = defaultLayout
+	v.stamp = stamp
+	return nil
+}
+
+// changed reports whether template files were added, removed or modified since they were loaded.
+func (v *ViewEngine) changed() bool {
+	stamp, err := v.walk(nil)
+	return err != nil || stamp != v.stamp
+}
+
+// walk calls fn, if not nil, with the name and path of every template file in the directory, and
+// returns a stamp of their names, sizes and modification times used to detect changes.
+func (v *ViewEngine) walk(fn func(name, file string) error) (string, error) {
+	var stamp strings.Builder
+	err := fs.WalkDir(v.fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(file) != v.ext {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(file, v.ext)
+		fmt.Fprintf(&stamp, "%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+		if fn != nil {
+			return fn(name, file)
+		}
+		return nil
+	})
+	return stamp.String(), err
+}
+
+// Render renders the named view with data as an HTML response, wrapped in the view engine's default layout.
+// It returns an error if no view engine is configured or the view cannot be loaded; errors while
+// executing the template result in a 500 response, see Response.Send.
+func (c *Context) Render(name string, data interface{}) error {
+	if c.views == nil {
+		return fmt.Errorf("expresso: no view engine configured, see App.Views")
+	}
+	tmpl, err := c.views.Lookup(name)
+	if err != nil {
+		return err
+	}
+	c.Send(Template{Tmpl: tmpl, Data: data})
+	return nil
+}
+
+// RenderLayout is like Render but wraps the view in the given layout, e.g. "layouts/admin",
+// instead of the view engine's default. An empty layout renders the view alone.
+func (c *Context) RenderLayout(name, layout string, data interface{}) error {
+	if c.views == nil {
+		return fmt.Errorf("expresso: no view engine configured, see App.Views")
+	}
+	tmpl, err := c.views.LookupLayout(name, layout)
+	if err != nil {
+		return err
+	}
+	c.Send(Template{Tmpl: tmpl, Data: data})
+	return nil
+}
+
+// execute renders the template into memory so that errors can still result in a 500 response.
+func (t Template) execute() ([]byte, error) {
+	if t.Tmpl == nil {
+		return nil, fmt.Errorf("expresso: template is nil")
+	}
+	var buf bytes.Buffer
+	if err := t.Tmpl.Execute(&buf, t.Data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// contentType returns the MIME type of the rendered template, defaulting to "text/html".
+func (t Template) contentType() string {
+	if t.ContentType == "" {
+		return "text/html"
+	}
+	return t.ContentType
+}
@@ -0,0 +1,225 @@
+package expresso
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// viewFiles returns templates exercising layouts, blocks, partials and custom functions.
+func viewFiles() fstest.MapFS {
+	return fstest.MapFS{
+		"layouts/main.html":    {Data: []byte(`<main><title>{{ block "title" . }}Main{{ end }}</title>{{ template "content" . }}</main>`)},
+		"layouts/admin.html":   {Data: []byte(`<admin><title>{{ block "title" . }}Admin{{ end }}</title>{{ template "content" . }}</admin>`)},
+		"partials/header.html": {Data: []byte(`<h1>{{ upper .Name }}</h1>`)},
+		"index.html":           {Data: []byte(`{{ template "partials/header" . }}<p>{{ .Name }}</p>`)},
+		"users/show.html":      {Data: []byte(`{{ define "title" }}User{{ end }}<p>{{ .Name }}</p>`)},
+		"broken.html":          {Data: []byte(`<p>{{ fail }}</p>`)},
+		"notes.txt":            {Data: []byte(`not a template {{`)},
+	}
+}
+
+// newViewsApp returns an App rendering the view named by the "view" query parameter with the
+// layout named by the "layout" parameter, or the default layout if there is none.
+func newViewsApp(files fstest.MapFS, configure func(v *ViewEngine)) *App {
+	app := newTestApp()
+	views := app.ViewsFS(files, "html").Funcs(template.FuncMap{
+		"upper": strings.ToUpper,
+		"fail": func() (string, error) {
+			return "", errors.New("boom")
+		},
+	})
+	if configure != nil {
+		configure(views)
+	}
+	app.GET("/", Catch(func(ctx *Context) error {
+		data := map[string]string{"Name": "ana"}
+		query := ctx.RawRequest.URL.Query()
+		if layout, ok := query["layout"]; ok {
+			return ctx.RenderLayout(query.Get("view"), layout[0], data)
+		}
+		return ctx.Render(query.Get("view"), data)
+	}))
+	return app
+}
+
+func renderView(app *App, target string) *httptest.ResponseRecorder {
+	return serve(app, httptest.NewRequest(http.MethodGet, target, nil))
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(v *ViewEngine)
+		target    string
+		body      string
+	}{
+		{"default layout with partial", nil, "/?view=index", `<main><title>Main</title><h1>ANA</h1><p>ana</p></main>`},
+		{"block override", nil, "/?view=users/show", `<main><title>User</title><p>ana</p></main>`},
+		{"layout per render", nil, "/?view=index&layout=layouts/admin", `<admin><title>Admin</title><h1>ANA</h1><p>ana</p></admin>`},
+		{"block override per render", nil, "/?view=users/show&layout=layouts/admin", `<admin><title>User</title><p>ana</p></admin>`},
+		{"no layout per render", nil, "/?view=index&layout=", `<h1>ANA</h1><p>ana</p>`},
+		{"configured layout", func(v *ViewEngine) { v.Layout("layouts/admin") }, "/?view=index", `<admin><title>Admin</title><h1>ANA</h1><p>ana</p></admin>`},
+		{"configured without layout", func(v *ViewEngine) { v.Layout("") }, "/?view=users/show", `<p>ana</p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := renderView(newViewsApp(viewFiles(), tt.configure), tt.target)
+			if w.Code != http.StatusOK || w.Body.String() != tt.body {
+				t.Errorf("got %d %q, want 200 %q", w.Code, w.Body, tt.body)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+				t.Errorf("Content-Type = %q, want text/html", ct)
+			}
+		})
+	}
+}
+
+func TestRenderWithoutMainLayout(t *testing.T) {
+	files := viewFiles()
+	delete(files, "layouts/main.html")
+
+	w := renderView(newViewsApp(files, nil), "/?view=index")
+	if want := `<h1>ANA</h1><p>ana</p>`; w.Body.String() != want {
+		t.Errorf("body = %q, want %q", w.Body, want)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		err    string
+	}{
+		{"missing view", "/?view=missing", `view "missing" not found`},
+		{"partials are not views", "/?view=partials/header", `view "partials/header" not found`},
+		{"missing layout", "/?view=index&layout=layouts/missing", `layout "layouts/missing" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newViewsApp(viewFiles(), nil)
+			query := httptest.NewRequest(http.MethodGet, tt.target, nil).URL.Query()
+			var err error
+			if layout, ok := query["layout"]; ok {
+				_, err = app.views.LookupLayout(query.Get("view"), layout[0])
+			} else {
+				_, err = app.views.Lookup(query.Get("view"))
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("lookup error = %v, want it to contain %q", err, tt.err)
+			}
+
+			if w := renderView(app, tt.target); w.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want 500", w.Code)
+			}
+		})
+	}
+}
+
+func TestRenderExecuteError(t *testing.T) {
+	w := renderView(newViewsApp(viewFiles(), nil), "/?view=broken")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "<main>") {
+		t.Errorf("body = %q, want no partially rendered page", w.Body)
+	}
+}
+
+func TestRenderWithoutViews(t *testing.T) {
+	app := newTestApp()
+	var err error
+	app.GET("/", func(ctx *Context) {
+		err = ctx.Render("index", nil)
+	})
+	renderView(app, "/")
+	if err == nil || !strings.Contains(err.Error(), "no view engine configured") {
+		t.Errorf("Render error = %v, want no view engine configured", err)
+	}
+}
+
+func TestViewsLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		src       string
+		configure func(v *ViewEngine)
+		err       string
+	}{
+		{"valid", "", "", nil, ""},
+		{"view syntax error", "users/index.html", `{{ .Name`, nil, `parsing view "users/index"`},
+		{"partial syntax error", "partials/footer.html", `{{ end }}`, nil, "parsing partial"},
+		// Layouts are parsed even if they are not the default.
+		{"layout syntax error", "layouts/print.html", `{{ if }}`, nil, "parsing layout"},
+		{"missing configured layout", "", "", func(v *ViewEngine) { v.Layout("layouts/missing") }, `layout "layouts/missing" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := viewFiles()
+			if tt.file != "" {
+				files[tt.file] = &fstest.MapFile{Data: []byte(tt.src)}
+			}
+			app := newViewsApp(files, tt.configure)
+
+			err := app.prepare()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("prepare() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("prepare() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestViewsReload(t *testing.T) {
+	for _, development := range []bool{false, true} {
+		files := viewFiles()
+		app := newViewsApp(files, nil)
+		app.Development = development
+		if err := app.prepare(); err != nil {
+			t.Fatal(err)
+		}
+
+		files["index.html"] = &fstest.MapFile{Data: []byte(`<p>changed</p>`), ModTime: time.Now()}
+		files["about.html"] = &fstest.MapFile{Data: []byte(`<p>about</p>`)}
+
+		want, wantAbout := `<main><title>Main</title><h1>ANA</h1><p>ana</p></main>`, http.StatusInternalServerError
+		if development {
+			want, wantAbout = `<main><title>Main</title><p>changed</p></main>`, http.StatusOK
+		}
+		if w := renderView(app, "/?view=index"); w.Body.String() != want {
+			t.Errorf("development %v: body = %q, want %q", development, w.Body, want)
+		}
+		if w := renderView(app, "/?view=about"); w.Code != wantAbout {
+			t.Errorf("development %v: new view status = %d, want %d", development, w.Code, wantAbout)
+		}
+	}
+}
+
+func TestViewsReloadAfterError(t *testing.T) {
+	files := viewFiles()
+	app := newViewsApp(files, nil)
+	app.Development = true
+	if err := app.prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	files["index.html"] = &fstest.MapFile{Data: []byte(`{{ .Name`)}
+	if _, err := app.views.Lookup("index"); err == nil {
+		t.Error("Lookup after a syntax error was introduced succeeded, want the parse error")
+	}
+
+	files["index.html"] = &fstest.MapFile{Data: []byte(`<p>fixed</p>`)}
+	if w := renderView(app, "/?view=index"); w.Body.String() != `<main><title>Main</title><p>fixed</p></main>` {
+		t.Errorf("body after fixing the view = %q", w.Body)
+	}
+}
@@ -0,0 +1,592 @@
+package expresso
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket message types, as defined by the frame opcodes in RFC 6455.
+const (
+	TextMessage   = 1  // A UTF-8 encoded text message.
+	BinaryMessage = 2  // A binary data message.
+	CloseMessage  = 8  // A close control message.
+	PingMessage   = 9  // A ping control message.
+	PongMessage   = 10 // A pong control message.
+)
+
+// WebSocket close codes, as defined in RFC 6455, section 7.4.1.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+// websocketCloseTimeout bounds the time spent sending a close message when the server closes a
+// connection on its own initiative, e.g. on shutdown or when a slow client is evicted.
+const websocketCloseTimeout = time.Second
+
+// DefaultWebSocketReadLimit is the default maximum size in bytes of a message read from a WebSocket.
+const DefaultWebSocketReadLimit = 32 << 20
+
+// websocketGUID is appended to the client's key to compute Sec-WebSocket-Accept.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// deflateTail is the empty stored block that ends every message compressed with permessage-deflate.
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// flateWriters pools the compressors used for permessage-deflate, which are expensive to allocate.
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		fw, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return fw
+	},
+}
+
+// ErrCloseSent is returned when writing to a WebSocket after a close message was sent.
+var ErrCloseSent = errors.New("expresso: websocket close sent")
+
+// CloseError is returned by WebSocket reads once the connection has been closed,
+// either by the client or because of a protocol violation.
+type CloseError struct {
+	Code int    // The close code, see CloseNormalClosure and the other close codes.
+	Text string // The reason given for the closure, if any.
+}
+
+// Error returns the close code and reason.
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("websocket: close %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: close %d: %s", e.Code, e.Text)
+}
+
+// WebSocketHandler handles an upgraded WebSocket connection. The connection is closed when it returns.
+type WebSocketHandler func(*WebSocket)
+
+// WebSocket is a server-side RFC 6455 WebSocket connection, created by routes registered with App.WS.
+// Reads must be done from a single goroutine, while writes may be done from any number of goroutines.
+// Ping messages are answered automatically.
+type WebSocket struct {
+	Context *Context // The context of the upgrade request, including Extras set by middleware.
+
+	conn         net.Conn
+	br           *bufio.Reader
+	compress     bool          // Whether permessage-deflate was negotiated.
+	readLimit    int64         // The maximum size of a message, see SetReadLimit.
+	writeTimeout time.Duration // The deadline for each write, zero for none.
+	pongHandler  func(data []byte)
+
+	writeMu   sync.Mutex
+	closeSent bool
+}
+
+// WS registers a WebSocket route for the specified path. The middleware runs before the upgrade,
+// so it can reject the request with a regular HTTP response, e.g. when authentication fails.
+// Browsers send cookies with cross-site handshakes, so those are rejected with 403 Forbidden
+// unless accepted by Config.WebSocketCheckOrigin.
+func (a *App) WS(path string, handler WebSocketHandler, middlewares ...Middleware) {
+	chain := make([]Middleware, 0, len(middlewares)+1)
+	chain = append(chain, middlewares...)
+	chain = append(chain, a.upgrade(handler))
+	a.router.GET(path, a.handle(chain...))
+}
+
+// WS registers a WebSocket route for the specified path within the group.
+func (g *Group) WS(path string, handler WebSocketHandler, middlewares ...Middleware) {
+	g.app.WS(g.path(path), handler, g.chain(middlewares)...)
+}
+
+// sameOrigin reports whether the Origin of r, if any, has the same host as the request, as sent by
+// a browser for a page served by this App. Clients other than browsers usually send no Origin.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// upgrade returns the middleware performing the WebSocket opening handshake and running handler.
+func (a *App) upgrade(handler WebSocketHandler) Middleware {
+	return func(ctx *Context) {
+		headers := ctx.Request.Headers
+		if ctx.Request.Method != http.MethodGet ||
+			!headerContainsToken(headers, "Connection", "upgrade") ||
+			!headerContainsToken(headers, "Upgrade", "websocket") {
+			ctx.Fail(NewHTTPError(http.StatusBadRequest, "websocket upgrade required", nil))
+			return
+		}
+		if headers.Get("Sec-WebSocket-Version") != "13" {
+			ctx.Response.Headers.Set("Sec-WebSocket-Version", "13")
+			ctx.Fail(NewHTTPError(http.StatusUpgradeRequired, "unsupported websocket version", nil))
+			return
+		}
+		key := headers.Get("Sec-WebSocket-Key")
+		if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+			ctx.Fail(NewHTTPError(http.StatusBadRequest, "invalid Sec-WebSocket-Key", nil))
+			return
+		}
+
+		checkOrigin := a.Config.WebSocketCheckOrigin
+		if checkOrigin == nil {
+			checkOrigin = sameOrigin
+		}
+		if !checkOrigin(ctx.RawRequest) {
+			ctx.Fail(NewHTTPError(http.StatusForbidden, "websocket origin not allowed", nil))
+			return
+		}
+
+		hijacker, ok := ctx.Response.w.(http.Hijacker)
+		if !ok {
+			ctx.Fail(errors.New("expresso: websocket upgrade is not supported by the response writer"))
+			return
+		}
+
+		compress := a.Config.WebSocketCompression && acceptsDeflate(headers)
+
+		conn, brw, err := hijacker.Hijack()
+		if err != nil {
+			ctx.Fail(fmt.Errorf("expresso: websocket hijack: %w", err))
+			return
+		}
+		// The server's read and write timeouts do not apply to the upgraded connection.
+		_ = conn.SetDeadline(time.Time{})
+
+		var b strings.Builder
+		b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		b.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+		if compress {
+			b.WriteString("Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover\r\n")
+		}
+		for k, v := range ctx.Response.Headers {
+			b.WriteString(k + ": " + strings.Join(v, ",") + "\r\n")
+		}
+		b.WriteString("\r\n")
+		if _, err := conn.Write([]byte(b.String())); err != nil {
+			conn.Close()
+			ctx.Error("websocket handshake: " + err.Error())
+			return
+		}
+
+		ws := &WebSocket{
+			Context:      ctx,
+			conn:         conn,
+			br:           brw.Reader,
+			compress:     compress,
+			readLimit:    DefaultWebSocketReadLimit,
+			writeTimeout: a.Config.WriteTimeout,
+		}
+		a.lifecycle.track(ws)
+		defer a.lifecycle.untrack(ws)
+		defer ws.Close(CloseNormalClosure, "")
+		handler(ws)
+	}
+}
+
+// acceptKey computes the Sec-WebSocket-Accept value for the client's Sec-WebSocket-Key.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContainsToken reports whether the comma separated header contains token, case-insensitively.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// acceptsDeflate reports whether the client offers permessage-deflate with parameters the server supports.
+// The server compresses every message independently, so it accepts any offer that lets it use a 32KB window.
+func acceptsDeflate(header http.Header) bool {
+	for _, value := range header.Values("Sec-WebSocket-Extensions") {
+		for _, offer := range strings.Split(value, ",") {
+			params := strings.Split(offer, ";")
+			if strings.TrimSpace(params[0]) != "permessage-deflate" {
+				continue
+			}
+			supported := true
+			for _, param := range params[1:] {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				switch name {
+				case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+				case "server_max_window_bits":
+					if strings.Trim(value, `"`) != "15" {
+						supported = false
+					}
+				default:
+					supported = false
+				}
+			}
+			if supported {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetReadLimit sets the maximum size in bytes of a message read from the client.
+// Larger messages close the connection with CloseMessageTooBig.
+func (ws *WebSocket) SetReadLimit(limit int64) {
+	ws.readLimit = limit
+}
+
+// SetReadDeadline sets the deadline for reading the next message. A zero value means no deadline.
+func (ws *WebSocket) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+// SetPongHandler sets a function called with the payload of every pong received, e.g. to extend the read deadline.
+func (ws *WebSocket) SetPongHandler(handler func(data []byte)) {
+	ws.pongHandler = handler
+}
+
+// RemoteAddr returns the network address of the client.
+func (ws *WebSocket) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+// ReadMessage reads the next text or binary message, reassembling fragmented messages.
+// Control messages are handled while reading. Once the connection is closed, by the client
+// or because of a protocol violation, it returns a *CloseError.
+func (ws *WebSocket) ReadMessage() (messageType int, data []byte, err error) {
+	var compressed bool
+	for {
+		f, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, ws.fail(err)
+		}
+
+		switch f.opcode {
+		case PingMessage:
+			if err := ws.writeFrame(PongMessage, f.payload, false); err != nil && !errors.Is(err, ErrCloseSent) {
+				return 0, nil, ws.fail(err)
+			}
+			continue
+		case PongMessage:
+			if ws.pongHandler != nil {
+				ws.pongHandler(f.payload)
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, ws.closeReceived(f.payload)
+		case 0:
+			if messageType == 0 {
+				return 0, nil, ws.fail(&CloseError{CloseProtocolError, "unexpected continuation frame"})
+			}
+		default:
+			if messageType != 0 {
+				return 0, nil, ws.fail(&CloseError{CloseProtocolError, "expected continuation frame"})
+			}
+			messageType = int(f.opcode)
+			compressed = f.rsv1
+		}
+
+		if int64(len(data))+int64(len(f.payload)) > ws.readLimit {
+			return 0, nil, ws.fail(&CloseError{CloseMessageTooBig, "message too big"})
+		}
+		data = append(data, f.payload...)
+		if f.fin {
+			break
+		}
+	}
+
+	if compressed {
+		if data, err = ws.inflate(data); err != nil {
+			return 0, nil, ws.fail(err)
+		}
+	}
+	if messageType == TextMessage && !utf8.Valid(data) {
+		return 0, nil, ws.fail(&CloseError{CloseInvalidFramePayloadData, "invalid UTF-8 in text message"})
+	}
+	return messageType, data, nil
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v.
+func (ws *WebSocket) ReadJSON(v interface{}) error {
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WriteMessage sends a text or binary message, compressed if permessage-deflate was negotiated.
+func (ws *WebSocket) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("expresso: invalid websocket message type %d", messageType)
+	}
+	if !ws.compress {
+		return ws.writeFrame(byte(messageType), data, false)
+	}
+
+	var buf bytes.Buffer
+	fw := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(fw)
+	fw.Reset(&buf)
+	if _, err := fw.Write(data); err != nil {
+		return err
+	}
+	if err := fw.Flush(); err != nil {
+		return err
+	}
+	return ws.writeFrame(byte(messageType), bytes.TrimSuffix(buf.Bytes(), deflateTail), true)
+}
+
+// WriteText sends a text message.
+func (ws *WebSocket) WriteText(text string) error {
+	return ws.WriteMessage(TextMessage, []byte(text))
+}
+
+// WriteJSON sends v encoded as JSON in a text message.
+func (ws *WebSocket) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(TextMessage, data)
+}
+
+// Ping sends a ping message. The client's pong is passed to the handler set with SetPongHandler.
+func (ws *WebSocket) Ping(data []byte) error {
+	if len(data) > 125 {
+		return errors.New("expresso: websocket control payload exceeds 125 bytes")
+	}
+	return ws.writeFrame(PingMessage, data, false)
+}
+
+// Close sends a close message with the given code and reason, then closes the connection.
+// It is called with CloseNormalClosure when the handler returns, and is safe to call more than once.
+func (ws *WebSocket) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+
+	err := ws.writeFrame(CloseMessage, payload, false)
+	if errors.Is(err, ErrCloseSent) {
+		return nil
+	}
+	ws.conn.Close()
+	return err
+}
+
+// closeWithin closes the connection like Close, but gives up on the close message after timeout.
+// The deadline also interrupts a write blocked on a client that stopped reading, which holds the
+// write lock Close needs.
+func (ws *WebSocket) closeWithin(code int, reason string, timeout time.Duration) {
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(timeout))
+	ws.writeMu.Lock()
+	ws.writeTimeout = 0 // Keep the deadline set above for the close message.
+	ws.writeMu.Unlock()
+	_ = ws.Close(code, reason)
+	ws.conn.Close()
+}
+
+// frame is a single WebSocket frame read from the client, with its payload unmasked.
+type frame struct {
+	fin     bool
+	rsv1    bool
+	opcode  byte
+	payload []byte
+}
+
+// readFrame reads and validates the next frame from the client.
+func (ws *WebSocket) readFrame() (frame, error) {
+	var f frame
+	var header [8]byte
+	if _, err := io.ReadFull(ws.br, header[:2]); err != nil {
+		return f, err
+	}
+
+	f.fin = header[0]&0x80 != 0
+	f.rsv1 = header[0]&0x40 != 0
+	f.opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+
+	switch {
+	case header[0]&0x30 != 0:
+		return f, &CloseError{CloseProtocolError, "reserved bits set"}
+	case f.rsv1 && (!ws.compress || f.opcode == 0 || f.opcode >= CloseMessage):
+		return f, &CloseError{CloseProtocolError, "unexpected compressed frame"}
+	case !masked:
+		return f, &CloseError{CloseProtocolError, "client frames must be masked"}
+	}
+
+	switch f.opcode {
+	case 0, TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if !f.fin || length > 125 {
+			return f, &CloseError{CloseProtocolError, "invalid control frame"}
+		}
+	default:
+		return f, &CloseError{CloseProtocolError, fmt.Sprintf("unknown opcode %d", f.opcode)}
+	}
+
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(ws.br, header[:2]); err != nil {
+			return f, err
+		}
+		length = uint64(binary.BigEndian.Uint16(header[:2]))
+	case 127:
+		if _, err := io.ReadFull(ws.br, header[:8]); err != nil {
+			return f, err
+		}
+		length = binary.BigEndian.Uint64(header[:8])
+	}
+	if length > uint64(ws.readLimit) {
+		return f, &CloseError{CloseMessageTooBig, "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.br, mask[:]); err != nil {
+		return f, err
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.br, f.payload); err != nil {
+		return f, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+// writeFrame sends a single unmasked frame with the FIN bit set.
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte, compressed bool) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+	if opcode == CloseMessage {
+		ws.closeSent = true
+	}
+
+	header := make([]byte, 2, 10+len(payload))
+	header[0] = 0x80 | opcode
+	if compressed {
+		header[0] |= 0x40
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	if ws.writeTimeout > 0 {
+		_ = ws.conn.SetWriteDeadline(time.Now().Add(ws.writeTimeout))
+	}
+	_, err := ws.conn.Write(append(header, payload...))
+	return err
+}
+
+// inflate decompresses a message compressed with permessage-deflate, enforcing the read limit.
+func (ws *WebSocket) inflate(data []byte) ([]byte, error) {
+	// The final block lets the decompressor report io.EOF at the end of the message.
+	tail := []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+	fr := flate.NewReader(io.MultiReader(bytes.NewReader(data), bytes.NewReader(tail)))
+	defer fr.Close()
+
+	inflated, err := io.ReadAll(io.LimitReader(fr, ws.readLimit+1))
+	if err != nil {
+		return nil, &CloseError{CloseInvalidFramePayloadData, "invalid compressed message"}
+	}
+	if int64(len(inflated)) > ws.readLimit {
+		return nil, &CloseError{CloseMessageTooBig, "message too big"}
+	}
+	return inflated, nil
+}
+
+// closeReceived answers the client's close message and closes the connection.
+func (ws *WebSocket) closeReceived(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return ws.fail(&CloseError{CloseProtocolError, "invalid close payload"})
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[2:])
+		if !validCloseCode(closeErr.Code) {
+			return ws.fail(&CloseError{CloseProtocolError, "invalid close code"})
+		}
+		if !utf8.ValidString(closeErr.Text) {
+			return ws.fail(&CloseError{CloseInvalidFramePayloadData, "invalid UTF-8 in close reason"})
+		}
+	}
+
+	// Echo the client's status code, or send an empty close message if it sent none.
+	if closeErr.Code == CloseNoStatusReceived {
+		_ = ws.writeFrame(CloseMessage, nil, false)
+		ws.conn.Close()
+	} else {
+		_ = ws.Close(closeErr.Code, "")
+	}
+	return closeErr
+}
+
+// validCloseCode reports whether code may be sent in a close message.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// fail closes the connection after a read error. Protocol violations are reported to the client
+// with the matching close code; other errors close the connection abnormally.
+func (ws *WebSocket) fail(err error) error {
+	var closeErr *CloseError
+	if errors.As(err, &closeErr) {
+		_ = ws.Close(closeErr.Code, closeErr.Text)
+		return closeErr
+	}
+	ws.conn.Close()
+	return &CloseError{Code: CloseAbnormalClosure, Text: err.Error()}
+}
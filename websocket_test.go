@@ -0,0 +1,364 @@
+package expresso
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsClient is a minimal WebSocket client speaking raw frames, for testing the server side.
+type wsClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+	res  *http.Response
+}
+
+// dialWS connects to path on the server at url and performs the opening handshake with extra headers.
+func dialWS(t *testing.T, url, path string, header http.Header) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req, _ := http.NewRequest("GET", url+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &wsClient{t: t, conn: conn, br: br, res: res}
+}
+
+// writeFrame sends a masked frame.
+func (c *wsClient) writeFrame(fin bool, rsv1 bool, opcode byte, payload []byte) {
+	c.writeRaw(fin, rsv1, opcode, payload, true)
+}
+
+// writeRaw sends a frame, masked or not.
+func (c *wsClient) writeRaw(fin, rsv1 bool, opcode byte, payload []byte, masked bool) {
+	c.t.Helper()
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	if rsv1 {
+		b0 |= 0x40
+	}
+	frame := []byte{b0, 0}
+	switch n := len(payload); {
+	case n <= 125:
+		frame[1] = byte(n)
+	case n <= 0xffff:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	data := append([]byte(nil), payload...)
+	if masked {
+		frame[1] |= 0x80
+		mask := []byte{1, 2, 3, 4}
+		frame = append(frame, mask...)
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+	}
+	if _, err := c.conn.Write(append(frame, data...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// readFrame reads an unmasked server frame.
+func (c *wsClient) readFrame() (opcode byte, rsv1 bool, payload []byte) {
+	c.t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		c.t.Fatalf("reading frame: %v", err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		c.t.Fatalf("server frame header %x: want FIN set and no mask", header)
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatalf("reading payload: %v", err)
+	}
+	return header[0] & 0x0f, header[0]&0x40 != 0, payload
+}
+
+// expectClose reads a close frame and checks its code.
+func (c *wsClient) expectClose(code int) {
+	c.t.Helper()
+	opcode, _, payload := c.readFrame()
+	if opcode != CloseMessage || len(payload) < 2 {
+		c.t.Fatalf("got opcode %d payload %q, want a close frame", opcode, payload)
+	}
+	if got := int(binary.BigEndian.Uint16(payload)); got != code {
+		c.t.Fatalf("close code = %d (%q), want %d", got, payload[2:], code)
+	}
+}
+
+// closePayload builds the payload of a close frame.
+func closePayload(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+// newEchoServer serves a WebSocket route at /ws echoing every message, returning the server URL.
+func newEchoServer(t *testing.T, configure func(app *App)) string {
+	app := newTestApp()
+	if configure != nil {
+		configure(app)
+	}
+	app.WS("/ws", func(ws *WebSocket) {
+		ws.SetReadLimit(1 << 10)
+		for {
+			messageType, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := ws.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	})
+	return startTestServer(t, app)
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	url := newEchoServer(t, nil)
+	c := dialWS(t, url, "/ws", nil)
+
+	if c.res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", c.res.StatusCode)
+	}
+	// The example from RFC 6455, section 1.3.
+	if got := c.res.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q", got)
+	}
+	if got := c.res.Header.Get("Sec-WebSocket-Extensions"); got != "" {
+		t.Errorf("Sec-WebSocket-Extensions = %q without compression enabled", got)
+	}
+}
+
+func TestWebSocketHandshakeErrors(t *testing.T) {
+	app := newTestApp()
+	app.WS("/ws", func(ws *WebSocket) {})
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"not an upgrade", map[string]string{}, http.StatusBadRequest},
+		{"wrong version", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8"}, http.StatusUpgradeRequired},
+		{"bad key", map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "short"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/ws", nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		w := serve(app, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if tt.status == http.StatusUpgradeRequired && w.Header().Get("Sec-WebSocket-Version") != "13" {
+			t.Errorf("%s: missing Sec-WebSocket-Version", tt.name)
+		}
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	url := newEchoServer(t, nil)
+	tests := []struct {
+		origin string
+		status int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{url, http.StatusSwitchingProtocols},
+		{strings.ToUpper(url), http.StatusSwitchingProtocols},
+		{"https://evil.example", http.StatusForbidden},
+		{"http://127.0.0.1:1", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.origin != "" {
+			header.Set("Origin", tt.origin)
+		}
+		if c := dialWS(t, url, "/ws", header); c.res.StatusCode != tt.status {
+			t.Errorf("Origin %q: status = %d, want %d", tt.origin, c.res.StatusCode, tt.status)
+		}
+	}
+
+	// A custom check replaces the same-origin default.
+	url = newEchoServer(t, func(app *App) {
+		app.Config.WebSocketCheckOrigin = func(r *http.Request) bool {
+			return r.Header.Get("Origin") == "https://app.example"
+		}
+	})
+	for origin, status := range map[string]int{"https://app.example": http.StatusSwitchingProtocols, url: http.StatusForbidden} {
+		if c := dialWS(t, url, "/ws", http.Header{"Origin": {origin}}); c.res.StatusCode != status {
+			t.Errorf("custom check, Origin %q: status = %d, want %d", origin, c.res.StatusCode, status)
+		}
+	}
+}
+
+func TestWebSocketFraming(t *testing.T) {
+	url := newEchoServer(t, nil)
+	c := dialWS(t, url, "/ws", nil)
+
+	c.writeFrame(true, false, TextMessage, []byte("hello"))
+	if opcode, _, payload := c.readFrame(); opcode != TextMessage || string(payload) != "hello" {
+		t.Fatalf("echo = %d %q", opcode, payload)
+	}
+
+	// A fragmented message, with a ping interleaved between its fragments.
+	c.writeFrame(false, false, BinaryMessage, []byte("frag"))
+	c.writeFrame(true, false, PingMessage, []byte("p"))
+	c.writeFrame(true, false, 0, []byte("mented"))
+	if opcode, _, payload := c.readFrame(); opcode != PongMessage || string(payload) != "p" {
+		t.Fatalf("pong = %d %q", opcode, payload)
+	}
+	if opcode, _, payload := c.readFrame(); opcode != BinaryMessage || string(payload) != "fragmented" {
+		t.Fatalf("echo = %d %q", opcode, payload)
+	}
+
+	// A 16-bit length payload.
+	long := bytes.Repeat([]byte("x"), 300)
+	c.writeFrame(true, false, BinaryMessage, long)
+	if _, _, payload := c.readFrame(); !bytes.Equal(payload, long) {
+		t.Fatalf("echo of %d bytes = %d bytes", len(long), len(payload))
+	}
+
+	c.writeFrame(true, false, CloseMessage, closePayload(CloseNormalClosure, "bye"))
+	c.expectClose(CloseNormalClosure)
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(c *wsClient)
+		code int
+	}{
+		{"unmasked frame", func(c *wsClient) { c.writeRaw(true, false, TextMessage, []byte("x"), false) }, CloseProtocolError},
+		{"unknown opcode", func(c *wsClient) { c.writeFrame(true, false, 3, nil) }, CloseProtocolError},
+		{"unexpected continuation", func(c *wsClient) { c.writeFrame(true, false, 0, []byte("x")) }, CloseProtocolError},
+		{"fragmented control frame", func(c *wsClient) { c.writeFrame(false, false, PingMessage, nil) }, CloseProtocolError},
+		{"compressed frame without deflate", func(c *wsClient) { c.writeFrame(true, true, TextMessage, []byte("x")) }, CloseProtocolError},
+		{"invalid UTF-8", func(c *wsClient) { c.writeFrame(true, false, TextMessage, []byte{0xff, 0xfe}) }, CloseInvalidFramePayloadData},
+		{"too big", func(c *wsClient) { c.writeFrame(true, false, BinaryMessage, make([]byte, 2<<10)) }, CloseMessageTooBig},
+		{"invalid close code", func(c *wsClient) { c.writeFrame(true, false, CloseMessage, closePayload(1005, "")) }, CloseProtocolError},
+	}
+	url := newEchoServer(t, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dialWS(t, url, "/ws", nil)
+			tt.send(c)
+			c.expectClose(tt.code)
+		})
+	}
+}
+
+func TestWebSocketDeflate(t *testing.T) {
+	url := newEchoServer(t, func(app *App) {
+		app.Config.WebSocketCompression = true
+	})
+	c := dialWS(t, url, "/ws", http.Header{"Sec-Websocket-Extensions": {"permessage-deflate; client_max_window_bits"}})
+	if ext := c.res.Header.Get("Sec-WebSocket-Extensions"); !strings.HasPrefix(ext, "permessage-deflate") {
+		t.Fatalf("Sec-WebSocket-Extensions = %q, want permessage-deflate", ext)
+	}
+
+	message := strings.Repeat("compress me ", 20)
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestCompression)
+	fw.Write([]byte(message))
+	fw.Flush()
+	c.writeFrame(true, true, TextMessage, bytes.TrimSuffix(buf.Bytes(), deflateTail))
+
+	opcode, rsv1, payload := c.readFrame()
+	if opcode != TextMessage || !rsv1 {
+		t.Fatalf("echo opcode %d rsv1 %v, want a compressed text message", opcode, rsv1)
+	}
+	inflated, err := io.ReadAll(flate.NewReader(io.MultiReader(bytes.NewReader(payload), bytes.NewReader([]byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}))))
+	if err != nil || string(inflated) != message {
+		t.Fatalf("inflated echo = %q (%v)", inflated, err)
+	}
+
+	// Uncompressed messages are still accepted.
+	c.writeFrame(true, false, TextMessage, []byte("plain"))
+	if _, _, payload := c.readFrame(); len(payload) == 0 {
+		t.Fatal("no echo for an uncompressed message")
+	}
+}
+
+func TestWebSocketDeflateUnsupportedOffer(t *testing.T) {
+	url := newEchoServer(t, func(app *App) {
+		app.Config.WebSocketCompression = true
+	})
+	c := dialWS(t, url, "/ws", http.Header{"Sec-Websocket-Extensions": {"permessage-deflate; server_max_window_bits=10"}})
+	if ext := c.res.Header.Get("Sec-WebSocket-Extensions"); ext != "" {
+		t.Fatalf("Sec-WebSocket-Extensions = %q, want no extension for an unsupported window size", ext)
+	}
+}
+
+func TestWebSocketClosedOnShutdown(t *testing.T) {
+	app := newTestApp()
+	app.Config.ShutdownTimeout = 5 * time.Second
+	ended := make(chan struct{})
+	app.WS("/ws", func(ws *WebSocket) {
+		defer close(ended)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	url := startTestServer(t, app)
+	c := dialWS(t, url, "/ws", nil)
+
+	if err := app.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	c.expectClose(CloseGoingAway)
+	select {
+	case <-ended:
+	case <-time.After(2 * time.Second):
+		t.Fatal("WebSocket handler still running after Shutdown")
+	}
+}